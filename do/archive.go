@@ -0,0 +1,213 @@
+package do
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// extractPath joins the archive entry name onto the destination directory,
+// refusing any entry that would end up outside of it
+func extractPath(dstDir, name string) (string, error) {
+	target := filepath.Join(dstDir, name)
+	rel, err := filepath.Rel(filepath.Clean(dstDir), target)
+	if err != nil {
+		return "", err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("illegal path in archive: %s", name)
+	}
+	return target, nil
+}
+
+// TarGz walks the provided directory and returns a gzip compressed tar archive
+// of its content as []byte. Paths are stored relative to dir and file modes
+// are preserved, only directories and regular files are archived. This
+// discards the content of the previous stage.
+func TarGz(dir string) StageFn {
+	return func(_ interface{}, progress io.Writer) (interface{}, error) {
+		ReportProgress(progress, "Creating tar.gz archive of directory: %s", dir)
+
+		var buf bytes.Buffer
+		gw := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gw)
+
+		err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() && !info.Mode().IsRegular() {
+				return nil
+			}
+			rel, err := filepath.Rel(dir, p)
+			if err != nil {
+				return err
+			}
+			if rel == "." {
+				return nil
+			}
+			hdr, err := tar.FileInfoHeader(info, "")
+			if err != nil {
+				return err
+			}
+			hdr.Name = filepath.ToSlash(rel)
+			if info.IsDir() {
+				hdr.Name += "/"
+			}
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+			f, err := os.Open(p)
+			if err != nil {
+				return err
+			}
+			defer func() {
+				_ = f.Close()
+			}()
+			_, err = io.Copy(tw, f)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := tw.Close(); err != nil {
+			return nil, err
+		}
+		if err := gw.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+}
+
+// Untar extracts the gzip compressed tar archive of the previous stage, as
+// []byte or *os.File, into the destination directory and returns the paths
+// that were extracted. Only directories and regular files are extracted, and
+// entries that would be written outside of dstDir result in an error.
+func Untar(dstDir string) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		r, err := readerOf(input)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			_ = r.Close()
+		}()
+		ReportProgress(progress, "Extracting tar.gz archive to: %s", dstDir)
+
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		tr := tar.NewReader(gr)
+
+		var extracted []string
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return extracted, err
+			}
+			target, err := extractPath(dstDir, hdr.Name)
+			if err != nil {
+				return extracted, err
+			}
+			switch hdr.Typeflag {
+			case tar.TypeDir:
+				if err := os.MkdirAll(target, os.FileMode(hdr.Mode).Perm()); err != nil {
+					return extracted, err
+				}
+			case tar.TypeReg:
+				if err := writeExtracted(target, os.FileMode(hdr.Mode).Perm(), tr); err != nil {
+					return extracted, err
+				}
+			default:
+				continue
+			}
+			extracted = append(extracted, target)
+		}
+		return extracted, nil
+	}
+}
+
+// Unzip extracts the zip archive of the previous stage, as []byte or *os.File,
+// into the destination directory and returns the paths that were extracted.
+// Entries that would be written outside of dstDir result in an error.
+func Unzip(dstDir string) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		var files []*zip.File
+		switch data := input.(type) {
+		case []byte:
+			zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				return nil, err
+			}
+			files = zr.File
+		case *os.File:
+			zr, err := zip.OpenReader(data.Name())
+			if err != nil {
+				return nil, err
+			}
+			defer func() {
+				_ = zr.Close()
+			}()
+			files = zr.File
+		default:
+			return nil, fmt.Errorf("provided input must be []byte or *os.File")
+		}
+		ReportProgress(progress, "Extracting zip archive to: %s", dstDir)
+
+		var extracted []string
+		for _, f := range files {
+			target, err := extractPath(dstDir, f.Name)
+			if err != nil {
+				return extracted, err
+			}
+			if f.FileInfo().IsDir() {
+				if err := os.MkdirAll(target, 0755); err != nil {
+					return extracted, err
+				}
+			} else {
+				rc, err := f.Open()
+				if err != nil {
+					return extracted, err
+				}
+				err = writeExtracted(target, f.Mode().Perm(), rc)
+				_ = rc.Close()
+				if err != nil {
+					return extracted, err
+				}
+			}
+			extracted = append(extracted, target)
+		}
+		return extracted, nil
+	}
+}
+
+func writeExtracted(target string, perm os.FileMode, r io.Reader) (err error) {
+	if err = os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	_, err = io.Copy(f, r)
+	return err
+}
@@ -0,0 +1,150 @@
+package do
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func tarGzOf(t *testing.T, name, content string) []byte {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	assert.Nil(t, tw.WriteHeader(&tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     int64(len(content)),
+		Typeflag: tar.TypeReg,
+	}))
+	_, err := tw.Write([]byte(content))
+	assert.Nil(t, err)
+	assert.Nil(t, tw.Close())
+	assert.Nil(t, gw.Close())
+	return buf.Bytes()
+}
+
+func zipOf(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range []string{"a.txt", "sub/", "sub/b.txt", "../evil.txt"} {
+		content, ok := files[name]
+		if !ok {
+			continue
+		}
+		w, err := zw.Create(name)
+		assert.Nil(t, err)
+		_, err = w.Write([]byte(content))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, zw.Close())
+	return buf.Bytes()
+}
+
+func TestArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	assert.Nil(t, err)
+
+	src := path.Join(dir, "src")
+	assert.Nil(t, os.MkdirAll(path.Join(src, "sub"), 0755))
+	assert.Nil(t, ioutil.WriteFile(path.Join(src, "a.txt"), []byte("hello"), 0644))
+	assert.Nil(t, ioutil.WriteFile(path.Join(src, "sub", "b.sh"), []byte("echo hi"), 0755))
+
+	testCases := []struct {
+		name        string
+		stages      []StageFn
+		expect      interface{}
+		expectError bool
+	}{
+		{
+			name: "tar.gz round trip",
+			stages: []StageFn{
+				TarGz(src),
+				Untar(path.Join(dir, "dst")),
+			},
+			expect: []string{
+				path.Join(dir, "dst", "a.txt"),
+				path.Join(dir, "dst", "sub"),
+				path.Join(dir, "dst", "sub", "b.sh"),
+			},
+			expectError: false,
+		},
+		{
+			name: "tar.gz round trip via temp file",
+			stages: []StageFn{
+				TarGz(src),
+				WriteTempFile,
+				Untar(path.Join(dir, "tmp")),
+				ReadFile(path.Join(dir, "tmp", "sub", "b.sh")),
+			},
+			expect:      []byte("echo hi"),
+			expectError: false,
+		},
+		{
+			name: "untar path traversal",
+			stages: []StageFn{
+				Insert(tarGzOf(t, "../evil.txt", "gotcha")),
+				Untar(path.Join(dir, "evil")),
+			},
+			expect:      fmt.Errorf("illegal path in archive: ../evil.txt"),
+			expectError: true,
+		},
+		{
+			name: "unzip",
+			stages: []StageFn{
+				Insert(zipOf(t, map[string]string{"a.txt": "a", "sub/": "", "sub/b.txt": "b"})),
+				Unzip(path.Join(dir, "zip")),
+			},
+			expect: []string{
+				path.Join(dir, "zip", "a.txt"),
+				path.Join(dir, "zip", "sub"),
+				path.Join(dir, "zip", "sub", "b.txt"),
+			},
+			expectError: false,
+		},
+		{
+			name: "unzip from file",
+			stages: []StageFn{
+				Insert(zipOf(t, map[string]string{"sub/b.txt": "b"})),
+				WriteTempFile,
+				Unzip(path.Join(dir, "zipfile")),
+				ReadFile(path.Join(dir, "zipfile", "sub", "b.txt")),
+			},
+			expect:      []byte("b"),
+			expectError: false,
+		},
+		{
+			name: "unzip path traversal",
+			stages: []StageFn{
+				Insert(zipOf(t, map[string]string{"../evil.txt": "gotcha"})),
+				Unzip(path.Join(dir, "evil")),
+			},
+			expect:      fmt.Errorf("illegal path in archive: ../evil.txt"),
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		got, err := Run(nil, tc.stages...)
+		if tc.expectError {
+			assert.Equal(t, tc.expect.(error).Error(), err.Error(), tc.name)
+		} else {
+			assert.Equal(t, tc.expect, got, tc.name)
+			assert.Nil(t, err, tc.name)
+		}
+	}
+
+	info, err := os.Stat(path.Join(dir, "dst", "sub", "b.sh"))
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+}
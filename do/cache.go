@@ -0,0 +1,117 @@
+package do
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Cache runs the provided stages as a sub-pipeline, with the input of the
+// previous stage and a copy of the variables, and stores their result in
+// dir, keyed by the SHA256 digest of the input. When dir already holds a
+// result for the input, it is returned without running the stages. The key
+// covers nothing but the content of the input, so a cached result must be
+// invalidated by removing it from dir when the stages change. The input
+// must be string, []byte or *os.File, and the result of the stages string
+// or []byte, which is always returned as []byte, whether it was cached or
+// not.
+func Cache(dir string, stages ...StageFn) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		data, ok := input.(interceptExec)
+		if !ok {
+			// Should never reach this point
+			return nil, fmt.Errorf("cache stage wasn't intercepted")
+		}
+		key, err := hexDigest(SHA256, data.Input)
+		if err != nil {
+			return nil, err
+		}
+		cached := filepath.Join(dir, key)
+
+		content, err := ioutil.ReadFile(cached)
+		if err == nil {
+			ReportProgress(progress, "Using cached result: %s", cached)
+			return content, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+
+		output, err := run(contextOf(data), progress, data.Input, copyVars(data.Vars), stages)
+		if err != nil {
+			return nil, err
+		}
+		content, err = contentOf(output)
+		if err != nil {
+			return nil, fmt.Errorf("result of cached stages: %s", err)
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+		ReportProgress(progress, "Caching result: %s", cached)
+		if err := writeAtomic(cached, content, 0666); err != nil {
+			return nil, err
+		}
+		return content, nil
+	}
+}
+
+// onceResult is the result of the stages of Once for a key, its gate is
+// held while they run, so that concurrent callers wait for them. The gate
+// is a channel rather than a mutex, so that a waiting caller can give up
+// when its pipeline is cancelled.
+type onceResult struct {
+	gate   chan struct{}
+	done   bool
+	output interface{}
+}
+
+// onceResults holds a *onceResult per key of Once
+var onceResults sync.Map
+
+// Once runs the provided stages as a sub-pipeline, with the input of the
+// previous stage and a copy of the variables, only the first time key is
+// seen, and returns their result for every later use of key, e.g., to
+// authenticate once for pipelines run repeatedly. The results are kept in
+// memory for the lifetime of the process, and shared by all pipelines of
+// it, which wait for the stages when they are running concurrently, until
+// their own pipeline is cancelled. Keys are global to the process, so
+// unrelated pipelines must not use the same key, e.g., prefix it with the
+// name of the package using it. A failure isn't kept, the stages run again
+// the next time key is seen. Note that files created during the first run,
+// such as temporary files, are cleaned up with its pipeline.
+func Once(key string, stages ...StageFn) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		data, ok := input.(interceptExec)
+		if !ok {
+			// Should never reach this point
+			return nil, fmt.Errorf("once stage wasn't intercepted")
+		}
+		v, _ := onceResults.LoadOrStore(key, &onceResult{gate: make(chan struct{}, 1)})
+		result := v.(*onceResult)
+		ctx := contextOf(data)
+		select {
+		case result.gate <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		defer func() {
+			<-result.gate
+		}()
+		if result.done {
+			ReportProgress(progress, "Using result of stages already run once: %s", key)
+			return result.output, nil
+		}
+
+		output, err := run(ctx, progress, data.Input, copyVars(data.Vars), stages)
+		if err != nil {
+			return nil, err
+		}
+		result.done = true
+		result.output = output
+		return output, nil
+	}
+}
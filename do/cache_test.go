@@ -0,0 +1,170 @@
+package do
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	assert.Nil(t, err)
+
+	cacheDir := path.Join(dir, "cache")
+	counter := path.Join(dir, "counter")
+	// Counts how often the cached stages actually run
+	expensive := Exec(fmt.Sprintf(`echo >> %s && echo -n "#{content}" | tr a-z A-Z`, counter))
+
+	testCases := []struct {
+		name        string
+		stages      []StageFn
+		expect      interface{}
+		expectError bool
+	}{
+		{
+			name: "cache miss",
+			stages: []StageFn{
+				Insert("hello"),
+				Cache(cacheDir, expensive),
+			},
+			expect:      []byte("HELLO"),
+			expectError: false,
+		},
+		{
+			name: "cache hit",
+			stages: []StageFn{
+				Insert([]byte("hello")),
+				Cache(cacheDir, expensive),
+			},
+			expect:      []byte("HELLO"),
+			expectError: false,
+		},
+		{
+			name: "cache hit from file",
+			stages: []StageFn{
+				Insert("hello"),
+				WriteTempFile,
+				Cache(cacheDir, Exec("exit 1")),
+			},
+			expect:      []byte("HELLO"),
+			expectError: false,
+		},
+		{
+			name: "cache other input",
+			stages: []StageFn{
+				Insert("there"),
+				Cache(cacheDir, expensive),
+			},
+			expect:      []byte("THERE"),
+			expectError: false,
+		},
+		{
+			name: "cache miss of string result",
+			stages: []StageFn{
+				Insert("string"),
+				Cache(cacheDir, Insert("result")),
+			},
+			expect:      []byte("result"),
+			expectError: false,
+		},
+		{
+			name: "cache hit of string result",
+			stages: []StageFn{
+				Insert("string"),
+				Cache(cacheDir, Exec("exit 1")),
+			},
+			expect:      []byte("result"),
+			expectError: false,
+		},
+		{
+			name: "cache invalid result",
+			stages: []StageFn{
+				Insert("answer"),
+				Cache(cacheDir, Insert(42)),
+			},
+			expect:      fmt.Errorf("result of cached stages: provided input must be string or []byte"),
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		got, err := Run(nil, tc.stages...)
+		if tc.expectError {
+			assert.Equal(t, tc.expect.(error).Error(), err.Error(), tc.name)
+		} else {
+			assert.Equal(t, tc.expect, got, tc.name)
+			assert.Nil(t, err, tc.name)
+		}
+	}
+
+	content, err := ioutil.ReadFile(counter)
+	assert.Nil(t, err)
+	assert.Equal(t, "\n\n", string(content), "cached stages should only run on a miss")
+}
+
+func TestOnce(t *testing.T) {
+	// Keys are global to the process, make them unique to this run of the
+	// test, so that it passes when run repeatedly
+	key := fmt.Sprintf("test-once-%d", time.Now().UnixNano())
+
+	var runs int32
+	setup := func(input interface{}, _ io.Writer) (interface{}, error) {
+		atomic.AddInt32(&runs, 1)
+		time.Sleep(10 * time.Millisecond)
+		return "token", nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := Run(nil, Once(key+"-setup", setup))
+			assert.Nil(t, err)
+			assert.Equal(t, "token", got)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&runs))
+
+	got, err := Run(nil, Insert("other"), Once(key+"-other", Exec(`echo -n "#{content}"`)))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("other"), got)
+
+	// Failures are not kept
+	_, err = Run(nil, Once(key+"-failing", Exec("exit 1")))
+	assert.Equal(t, "exit status 1", err.Error())
+	got, err = Run(nil, Once(key+"-failing", Insert("recovered")))
+	assert.Nil(t, err)
+	assert.Equal(t, "recovered", got)
+
+	// A cancelled pipeline doesn't wait for a slow first caller
+	slow := func(input interface{}, _ io.Writer) (interface{}, error) {
+		time.Sleep(time.Second)
+		return "slow", nil
+	}
+	go func() {
+		_, _ = Run(nil, Once(key+"-slow", slow))
+	}()
+	// Give the first caller time to take the gate
+	time.Sleep(50 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = RunContext(ctx, nil, Once(key+"-slow", slow))
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "%v", err)
+	assert.True(t, time.Since(start) < 500*time.Millisecond, "cancelled caller should stop waiting")
+}
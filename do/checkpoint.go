@@ -0,0 +1,126 @@
+package do
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// checkpointValue keeps track of the type of a checkpointed value, so that
+// []byte and string values are restored as such
+type checkpointValue struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+type checkpoint struct {
+	Input checkpointValue            `json:"input"`
+	Vars  map[string]checkpointValue `json:"vars"`
+}
+
+func toCheckpointValue(v interface{}) (checkpointValue, error) {
+	var kind string
+	switch v.(type) {
+	case *os.File:
+		return checkpointValue{}, fmt.Errorf("*os.File can't be checkpointed")
+	case []byte:
+		kind = "bytes"
+	case string:
+		kind = "string"
+	default:
+		kind = "json"
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return checkpointValue{}, err
+	}
+	return checkpointValue{Type: kind, Value: raw}, nil
+}
+
+func fromCheckpointValue(c checkpointValue) (interface{}, error) {
+	var err error
+	switch c.Type {
+	case "bytes":
+		var v []byte
+		err = json.Unmarshal(c.Value, &v)
+		return v, err
+	case "string":
+		var v string
+		err = json.Unmarshal(c.Value, &v)
+		return v, err
+	case "json":
+		var v interface{}
+		err = json.Unmarshal(c.Value, &v)
+		return v, err
+	default:
+		return nil, fmt.Errorf("unknown type of checkpointed value: %s", c.Type)
+	}
+}
+
+// Checkpoint writes the input of the previous stage, and the variables, to
+// the file, in the same way as WriteFileAtomic, so that a later run of the
+// pipeline can continue from here with Resume. The input is passed on
+// unchanged. Values are stored as JSON, where string and []byte values are
+// restored as such, and any other value is restored as decoded by
+// encoding/json into an interface{}. An *os.File can't be checkpointed.
+func Checkpoint(file string) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		data, ok := input.(interceptExec)
+		if !ok {
+			// Should never reach this point
+			return nil, fmt.Errorf("checkpoint stage wasn't intercepted")
+		}
+		c := checkpoint{Vars: map[string]checkpointValue{}}
+		var err error
+		if c.Input, err = toCheckpointValue(data.Input); err != nil {
+			return nil, fmt.Errorf("input: %w", err)
+		}
+		for name, v := range data.Vars {
+			if c.Vars[name], err = toCheckpointValue(v); err != nil {
+				return nil, fmt.Errorf("variable: %s: %w", name, err)
+			}
+		}
+		content, err := json.Marshal(c)
+		if err != nil {
+			return nil, err
+		}
+		ReportProgress(progress, "Writing checkpoint to file: %s", file)
+		if err := writeAtomic(file, content, 0666); err != nil {
+			return nil, err
+		}
+		return data.Input, nil
+	}
+}
+
+// Resume loads the input and the variables written by Checkpoint from the
+// file, and returns the input, so that the following stages continue where
+// the checkpointed pipeline left off. Variables that already exist are
+// overwritten.
+func Resume(file string) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		data, ok := input.(interceptExec)
+		if !ok {
+			// Should never reach this point
+			return nil, fmt.Errorf("resume stage wasn't intercepted")
+		}
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		ReportProgress(progress, "Resuming from checkpoint: %s", file)
+		var c checkpoint
+		if err := json.Unmarshal(content, &c); err != nil {
+			return nil, err
+		}
+		for name, cv := range c.Vars {
+			v, err := fromCheckpointValue(cv)
+			if err != nil {
+				return nil, fmt.Errorf("variable: %s: %w", name, err)
+			}
+			data.Vars[name] = v
+		}
+		return fromCheckpointValue(c.Input)
+	}
+}
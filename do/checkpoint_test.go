@@ -0,0 +1,55 @@
+package do
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	assert.Nil(t, err)
+	file := path.Join(dir, "checkpoint")
+
+	got, err := Run(nil,
+		Insert(map[string]interface{}{"count": 2}),
+		SaveInVar("config"),
+		Insert("hello"),
+		SaveInVar("greeting"),
+		Insert([]byte("there")),
+		Checkpoint(file),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("there"), got)
+
+	var vars map[string]interface{}
+	got, err = Run(nil,
+		Resume(file),
+		TransformVars(func(v map[string]interface{}) error {
+			vars = copyVars(v)
+			// Exec can only substitute string, []byte and *os.File variables
+			delete(v, "config")
+			return nil
+		}),
+		Exec(`echo -n "#{greeting} #{content}"`),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("hello there"), got)
+	assert.Equal(t, map[string]interface{}{
+		"greeting": "hello",
+		"config":   map[string]interface{}{"count": float64(2)},
+	}, vars)
+
+	_, err = Run(nil, Insert("hello"), WriteTempFile, Checkpoint(file))
+	assert.Equal(t, "input: *os.File can't be checkpointed", err.Error())
+
+	_, err = Run(nil, Resume(path.Join(dir, "missing")))
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+}
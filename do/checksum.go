@@ -0,0 +1,75 @@
+package do
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+)
+
+// HashAlgo names a supported hashing algorithm
+type HashAlgo string
+
+// The supported hashing algorithms
+const (
+	MD5    HashAlgo = "md5"
+	SHA1   HashAlgo = "sha1"
+	SHA256 HashAlgo = "sha256"
+	SHA512 HashAlgo = "sha512"
+)
+
+func (a HashAlgo) new() (hash.Hash, error) {
+	switch a {
+	case MD5:
+		return md5.New(), nil
+	case SHA1:
+		return sha1.New(), nil
+	case SHA256:
+		return sha256.New(), nil
+	case SHA512:
+		return sha512.New(), nil
+	default:
+		return nil, fmt.Errorf("unknown hash algorithm: %s, supported: %s, %s, %s, %s", a, MD5, SHA1, SHA256, SHA512)
+	}
+}
+
+// hexDigest hashes the string, []byte or *os.File input with the algorithm
+func hexDigest(algo HashAlgo, input interface{}) (string, error) {
+	h, err := algo.new()
+	if err != nil {
+		return "", err
+	}
+	r, err := readerOf(input)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// VerifyChecksum hashes the content of the previous stage and compares it
+// with the expected hex digest, the input is passed on unchanged if the
+// checksum matches, otherwise an error is returned.
+func VerifyChecksum(algo HashAlgo, expected string) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		ReportProgress(progress, "Verifying %s checksum of content", algo)
+		actual, err := hexDigest(algo, input)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.EqualFold(actual, expected) {
+			return nil, fmt.Errorf("%s checksum mismatch, expected: %s, actual: %s", algo, expected, actual)
+		}
+		return input, nil
+	}
+}
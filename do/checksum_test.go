@@ -0,0 +1,66 @@
+package do
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChecksum(t *testing.T) {
+	testCases := []struct {
+		name        string
+		stages      []StageFn
+		expect      interface{}
+		expectError bool
+	}{
+		{
+			name: "verify checksum",
+			stages: []StageFn{
+				Insert([]byte("hello")),
+				VerifyChecksum(SHA256, "2CF24DBA5FB0A30E26E83B2AC5B9E29E1B161E5C1FA7425E73043362938B9824"),
+			},
+			expect:      []byte("hello"),
+			expectError: false,
+		},
+		{
+			name: "verify checksum of file",
+			stages: []StageFn{
+				Insert("hello"),
+				WriteTempFile,
+				VerifyChecksum(MD5, "5d41402abc4b2a76b9719d911017c592"),
+				Exec("cat #{file}"),
+			},
+			expect:      []byte("hello"),
+			expectError: false,
+		},
+		{
+			name: "verify checksum mismatch",
+			stages: []StageFn{
+				Insert([]byte("hello")),
+				VerifyChecksum(SHA1, "abc"),
+			},
+			expect:      fmt.Errorf("sha1 checksum mismatch, expected: abc, actual: aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d"),
+			expectError: true,
+		},
+		{
+			name: "verify checksum unknown algorithm",
+			stages: []StageFn{
+				Insert([]byte("hello")),
+				VerifyChecksum(HashAlgo("crc"), "abc"),
+			},
+			expect:      fmt.Errorf("unknown hash algorithm: crc, supported: md5, sha1, sha256, sha512"),
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		got, err := Run(nil, tc.stages...)
+		if tc.expectError {
+			assert.Equal(t, tc.expect.(error).Error(), err.Error(), tc.name)
+		} else {
+			assert.Equal(t, tc.expect, got, tc.name)
+			assert.Nil(t, err, tc.name)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package do
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// LoadConfig reads the JSON file, or YAML file when its extension is .yaml
+// or .yml, into the pointer to struct to, failing on fields in the file that
+// to doesn't have. It then overrides the fields of to with the environment
+// variables that are set, so the environment wins over the file. The
+// variable of a field is named envPrefix followed by the upper cased field
+// name, or the name in its `env` tag, e.g., APP_PORT for the field Port with
+// the prefix APP_. Fields of nested structs are named after the path to
+// them, e.g., APP_DATABASE_HOST. No fields are overridden when envPrefix is
+// empty. The populated to is returned, this discards the content of the
+// previous stage.
+func LoadConfig(path string, to interface{}, envPrefix string) StageFn {
+	return func(_ interface{}, progress io.Writer) (interface{}, error) {
+		v := reflect.ValueOf(to)
+		if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+			return nil, fmt.Errorf("config must be a pointer to struct, got: %T", to)
+		}
+		ReportProgress(progress, "Loading config from file: %s", path)
+
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".yaml", ".yml":
+			err = yaml.UnmarshalStrict(content, to)
+		default:
+			err = decodeJSONStrict(content, to)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("config %s: %w", path, err)
+		}
+
+		if envPrefix != "" {
+			if err := overrideFromEnv(v.Elem(), envPrefix, progress); err != nil {
+				return nil, err
+			}
+		}
+		return to, nil
+	}
+}
+
+// decodeJSONStrict unmarshals the JSON document into to, failing on fields
+// that to doesn't have and on any content after the document, in the same
+// way as yaml.UnmarshalStrict for YAML
+func decodeJSONStrict(content []byte, to interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(content))
+	dec.DisallowUnknownFields()
+	return decodeDocument(dec, to)
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// overrideFromEnv sets the exported fields of the struct value from the
+// environment variables named prefix followed by the field name
+func overrideFromEnv(v reflect.Value, prefix string, progress io.Writer) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name := strings.ToUpper(f.Name)
+		if tag, ok := f.Tag.Lookup("env"); ok {
+			if tag == "-" {
+				continue
+			}
+			name = tag
+		}
+		name = prefix + name
+
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct && field.Type() != reflect.TypeOf(time.Time{}) {
+			if err := overrideFromEnv(field, name+"_", progress); err != nil {
+				return err
+			}
+			continue
+		}
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		ReportProgress(progress, "Overriding config field %s from environment variable: %s", f.Name, name)
+		if err := setField(field, value); err != nil {
+			return fmt.Errorf("environment variable: %s: cannot set field %s of type %s: %w", name, f.Name, field.Type(), err)
+		}
+	}
+	return nil
+}
+
+// setField parses the value into the field according to its kind
+func setField(field reflect.Value, value string) error {
+	if field.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(n)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type")
+		}
+		// Built element by element, as the elements may be of a named
+		// string type
+		parts := strings.Split(value, ",")
+		slice := reflect.MakeSlice(field.Type(), len(parts), len(parts))
+		for i, part := range parts {
+			slice.Index(i).SetString(strings.TrimSpace(part))
+		}
+		field.Set(slice)
+	default:
+		return fmt.Errorf("unsupported type")
+	}
+	return nil
+}
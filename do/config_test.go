@@ -0,0 +1,156 @@
+package do
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testMode string
+
+type testConfig struct {
+	Name     string        `json:"name" yaml:"name"`
+	Port     int           `json:"port" yaml:"port"`
+	Debug    bool          `json:"debug" yaml:"debug"`
+	Timeout  time.Duration `json:"timeout" yaml:"timeout"`
+	Tags     []string      `json:"tags" yaml:"tags"`
+	Modes    []testMode    `json:"modes" yaml:"modes"`
+	Database struct {
+		Host string `json:"host" yaml:"host" env:"HOSTNAME"`
+	} `json:"database" yaml:"database"`
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	assert.Nil(t, err)
+	for name, content := range map[string]string{
+		"config.json":   `{"name": "app", "port": 8080, "database": {"host": "localhost"}}`,
+		"config.yaml":   "name: app\nport: 8080\ndatabase:\n  host: localhost\n",
+		"invalid.json":  `{"port": "8080"}`,
+		"unknown.yml":   "name: app\nhost: localhost\n",
+		"unknown.json":  `{"name": "app", "host": "localhost"}`,
+		"trailing.json": `{"name": "app"} {"name": "other"}`,
+	} {
+		assert.Nil(t, ioutil.WriteFile(path.Join(dir, name), []byte(content), 0644))
+	}
+
+	for k, v := range map[string]string{
+		"GODO_TEST_PORT":              "9090",
+		"GODO_TEST_DEBUG":             "true",
+		"GODO_TEST_TIMEOUT":           "5s",
+		"GODO_TEST_TAGS":              "a, b",
+		"GODO_TEST_MODES":             "read, write",
+		"GODO_TEST_DATABASE_HOSTNAME": "db",
+		"GODO_INVALID_PORT":           "http",
+	} {
+		assert.Nil(t, os.Setenv(k, v))
+		defer func(k string) {
+			_ = os.Unsetenv(k)
+		}(k)
+	}
+
+	expect := &testConfig{Name: "app", Port: 9090, Debug: true, Timeout: 5 * time.Second, Tags: []string{"a", "b"}, Modes: []testMode{"read", "write"}}
+	expect.Database.Host = "db"
+
+	testCases := []struct {
+		name        string
+		stages      []StageFn
+		expect      interface{}
+		expectError bool
+	}{
+		{
+			name: "load JSON config",
+			stages: []StageFn{
+				LoadConfig(path.Join(dir, "config.json"), &testConfig{}, "GODO_TEST_"),
+			},
+			expect:      expect,
+			expectError: false,
+		},
+		{
+			name: "load YAML config",
+			stages: []StageFn{
+				LoadConfig(path.Join(dir, "config.yaml"), &testConfig{}, "GODO_TEST_"),
+			},
+			expect:      expect,
+			expectError: false,
+		},
+		{
+			name: "load config without env overrides",
+			stages: []StageFn{
+				LoadConfig(path.Join(dir, "config.json"), &testConfig{}, ""),
+			},
+			expect: func() *testConfig {
+				c := &testConfig{Name: "app", Port: 8080}
+				c.Database.Host = "localhost"
+				return c
+			}(),
+			expectError: false,
+		},
+		{
+			name: "load config invalid env",
+			stages: []StageFn{
+				LoadConfig(path.Join(dir, "config.json"), &testConfig{}, "GODO_INVALID_"),
+			},
+			expect:      fmt.Errorf(`environment variable: GODO_INVALID_PORT: cannot set field Port of type int: strconv.ParseInt: parsing "http": invalid syntax`),
+			expectError: true,
+		},
+		{
+			name: "load config invalid JSON",
+			stages: []StageFn{
+				LoadConfig(path.Join(dir, "invalid.json"), &testConfig{}, ""),
+			},
+			expect:      fmt.Errorf("config %s: json: cannot unmarshal string into Go struct field testConfig.port of type int", path.Join(dir, "invalid.json")),
+			expectError: true,
+		},
+		{
+			name: "load config unknown YAML field",
+			stages: []StageFn{
+				LoadConfig(path.Join(dir, "unknown.yml"), &testConfig{}, ""),
+			},
+			expect:      fmt.Errorf("config %s: yaml: unmarshal errors:\n  line 2: field host not found in type do.testConfig", path.Join(dir, "unknown.yml")),
+			expectError: true,
+		},
+		{
+			name: "load config unknown JSON field",
+			stages: []StageFn{
+				LoadConfig(path.Join(dir, "unknown.json"), &testConfig{}, ""),
+			},
+			expect:      fmt.Errorf(`config %s: json: unknown field "host"`, path.Join(dir, "unknown.json")),
+			expectError: true,
+		},
+		{
+			name: "load config trailing JSON content",
+			stages: []StageFn{
+				LoadConfig(path.Join(dir, "trailing.json"), &testConfig{}, ""),
+			},
+			expect:      fmt.Errorf("config %s: unexpected content after JSON document", path.Join(dir, "trailing.json")),
+			expectError: true,
+		},
+		{
+			name: "load config into non-pointer",
+			stages: []StageFn{
+				LoadConfig(path.Join(dir, "config.json"), testConfig{}, ""),
+			},
+			expect:      fmt.Errorf("config must be a pointer to struct, got: do.testConfig"),
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		got, err := Run(nil, tc.stages...)
+		if tc.expectError {
+			assert.Equal(t, tc.expect.(error).Error(), err.Error(), tc.name)
+		} else {
+			assert.Equal(t, tc.expect, got, tc.name)
+			assert.Nil(t, err, tc.name)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package do
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Deadline runs the provided stages as a sub-pipeline, with the input of the
+// previous stage and a copy of the variables, aborting it, and any command
+// it is executing, once it has run for longer than d. The deadline is
+// derived from the context of the pipeline, so the deadline of an outer
+// RunContext still applies, and the shorter of the two wins.
+func Deadline(d time.Duration, stages ...StageFn) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		data, ok := input.(interceptExec)
+		if !ok {
+			// Should never reach this point
+			return nil, fmt.Errorf("deadline stage wasn't intercepted")
+		}
+		ctx, cancel := context.WithTimeout(contextOf(data), d)
+		defer cancel()
+
+		ReportProgress(progress, "Running stages with a deadline of %s", d)
+		output, err := run(ctx, progress, data.Input, copyVars(data.Vars), stages)
+		if err != nil && errors.Is(err, context.DeadlineExceeded) && contextOf(data).Err() == nil {
+			return output, fmt.Errorf("deadline of %s exceeded: %w", d, err)
+		}
+		return output, err
+	}
+}
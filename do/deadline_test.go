@@ -0,0 +1,64 @@
+package do
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeadline(t *testing.T) {
+	testCases := []struct {
+		name        string
+		stages      []StageFn
+		expect      interface{}
+		expectError bool
+	}{
+		{
+			name: "deadline",
+			stages: []StageFn{
+				Insert("hello"),
+				SaveInVar("greeting"),
+				Insert("there"),
+				Deadline(time.Minute,
+					Exec(`echo -n "#{greeting} #{content}"`),
+				),
+			},
+			expect:      []byte("hello there"),
+			expectError: false,
+		},
+		{
+			name: "deadline exceeded",
+			stages: []StageFn{
+				Deadline(100*time.Millisecond,
+					Insert(nil),
+					Exec("sleep 5"),
+				),
+				Exec("echo -n unreachable"),
+			},
+			expect:      fmt.Errorf("deadline of 100ms exceeded: stage 1 (do.Exec.func1) interrupted: context deadline exceeded"),
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		got, err := Run(nil, tc.stages...)
+		if tc.expectError {
+			assert.Equal(t, tc.expect.(error).Error(), err.Error(), tc.name)
+		} else {
+			assert.Equal(t, tc.expect, got, tc.name)
+			assert.Nil(t, err, tc.name)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := RunContext(ctx, nil, Deadline(time.Minute, Exec("sleep 5")))
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.True(t, time.Since(start) < 5*time.Second)
+	assert.Equal(t, "stage 0 (do.Deadline.func1) interrupted: context deadline exceeded", err.Error())
+}
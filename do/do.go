@@ -2,6 +2,7 @@ package do
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -13,9 +14,13 @@ import (
 	"regexp"
 	"runtime"
 	"strings"
+	"time"
 )
 
-const temporaryFilePrefix = "godo-temporary-file"
+const (
+	temporaryFilePrefix = "godo-temporary-file"
+	execWaitDelay       = time.Second
+)
 
 // StageFn provides the signature for runnable segments. The developer
 // can provide their own stages if they so wish to.
@@ -25,54 +30,283 @@ type StageFn func(input interface{}, progress io.Writer) (output interface{}, er
 // of one stage is forwarded to the following stage, where the last
 // result is returned, unless an error occurs somewhere during execution.
 // The progress of the pipeline can be followed by providing a writer.
-func Run(progress io.Writer, stages ...StageFn) (input interface{}, err error) {
+func Run(progress io.Writer, stages ...StageFn) (interface{}, error) {
+	return RunContext(context.Background(), progress, stages...)
+}
+
+// RunContext executes the pipeline in the same way as Run, but stops when
+// the provided context is done, any running Exec stage is killed. The
+// returned error then wraps the context error and names the interrupted
+// stage by its zero based index and function name.
+func RunContext(ctx context.Context, progress io.Writer, stages ...StageFn) (interface{}, error) {
+	return run(ctx, progress, nil, map[string]interface{}{}, stages)
+}
+
+// RunWithRetry executes the pipeline in the same way as Run, but runs it again
+// from scratch when a stage fails, for up to the given number of attempts in
+// total, waiting backoff between each attempt. The pipeline must therefore be
+// idempotent. Each attempt cleans up its own temporary files, the error of
+// the last attempt is returned.
+func RunWithRetry(attempts int, backoff time.Duration, progress io.Writer, stages ...StageFn) (output interface{}, err error) {
+	if attempts < 1 {
+		return nil, fmt.Errorf("number of attempts must be at least 1, got: %d", attempts)
+	}
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			ReportProgress(progress, "Retrying pipeline in %s, attempt %d of %d", backoff, attempt, attempts)
+			time.Sleep(backoff)
+		}
+		if output, err = Run(progress, stages...); err == nil {
+			return output, nil
+		}
+		ReportProgress(progress, "Pipeline failed on attempt %d of %d: %s", attempt, attempts, err)
+	}
+	return output, err
+}
+
+// ContextFn is the signature of a stage that requires the context of the
+// pipeline, see WithContext
+type ContextFn func(ctx context.Context, input interface{}, progress io.Writer) (output interface{}, err error)
+
+// WithContext provides fn with the context of the pipeline, as passed to
+// RunContext, so that it can observe cancellation or pull request scoped
+// values, e.g., trace IDs, via ctx.Value. Such values are not part of the
+// data flowing through the pipeline, use SaveInVar for that instead.
+func WithContext(fn ContextFn) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		data, ok := input.(interceptExec)
+		if !ok {
+			// Should never reach this point
+			return nil, fmt.Errorf("context stage wasn't intercepted")
+		}
+		return fn(contextOf(data), data.Input, progress)
+	}
+}
+
+// run executes the stages with the provided initial input and variables
+func run(ctx context.Context, progress io.Writer, input interface{}, vars map[string]interface{}, stages []StageFn) (_ interface{}, err error) {
 	if progress == nil {
 		progress = ioutil.Discard
 	}
+	reporter, structured := progress.(stageReporter)
+	if !structured {
+		progress = synchronised(progress)
+	}
 
-	vars := map[string]interface{}{}
 	var closeFiles []*os.File
 	var removeTempFiles []*os.File
-ToExecution:
+	tracked := map[*os.File]bool{}
+	last := input
+	tracer := tracerOf(ctx)
+	recoverPanics := recoversPanics(ctx)
 	for _, stageFn := range stages {
+		if reflect.ValueOf(stageFn).Pointer() == reflect.ValueOf(RecoverPanics).Pointer() {
+			recoverPanics = true
+		}
+	}
+	if recoverPanics {
+		// Sub-pipelines recover panics as well
+		ctx = context.WithValue(ctx, recoverPanicsKey{}, true)
+	}
+ToExecution:
+	for i, stageFn := range stages {
 		fnName := runtime.FuncForPC(reflect.ValueOf(stageFn).Pointer()).Name()
-		if strings.Contains(fnName, runtime.FuncForPC(reflect.ValueOf(Exec).Pointer()).Name()) {
+		name := stageName(fnName)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			err = &PipelineError{
+				StageIndex: i,
+				Stage:      name,
+				LastValue:  last,
+				Err:        fmt.Errorf("pipeline cancelled before stage %d (%s): %w", i, name, ctxErr),
+			}
+			break
+		}
+		stageCtx, end := ctx, func(error) {}
+		if tracer != nil {
+			stageCtx, end = tracer.Start(ctx, name)
+		}
+		if isIntercepted(fnName) {
 			input = interceptExec{
 				Input: input,
 				Vars:  vars,
+				Ctx:   stageCtx,
 			}
 		}
-		if input, err = stageFn(input, progress); err != nil {
+		if recoverPanics {
+			stageFn = recovering(fmt.Sprintf("stage %d (%s)", i, name), stageFn)
+		}
+		stageProgress := progress
+		if structured {
+			stageProgress = reporter.forStage(i, name)
+		}
+		input, err = stageFn(input, stageProgress)
+		end(err)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				err = fmt.Errorf("stage %d (%s) interrupted: %w", i, name, ctxErr)
+			}
+			err = &PipelineError{StageIndex: i, Stage: name, LastValue: last, Err: err}
 			break
 		}
 		switch f := input.(type) {
 		case *os.File:
-			if strings.HasPrefix(path.Base(f.Name()), temporaryFilePrefix) {
-				removeTempFiles = append(removeTempFiles, f)
-			} else {
-				closeFiles = append(closeFiles, f)
+			// Stages may pass a file through, it must only be cleaned up once
+			if !tracked[f] {
+				tracked[f] = true
+				if strings.HasPrefix(path.Base(f.Name()), temporaryFilePrefix) {
+					removeTempFiles = append(removeTempFiles, f)
+				} else {
+					closeFiles = append(closeFiles, f)
+				}
 			}
 		case save:
 			if _, hasKey := vars[f.Var]; hasKey {
-				err = fmt.Errorf("variable: %s already exists", f.Var)
+				err = &PipelineError{
+					StageIndex: i,
+					Stage:      name,
+					LastValue:  last,
+					Err:        fmt.Errorf("variable: %s already exists", f.Var),
+				}
 				break ToExecution
 			}
 			vars[f.Var] = f.Val
+			last = f.Val
+			continue
 		}
+		last = input
 	}
+	// Clean up regardless, but don't mask the error of a failing stage
 	for _, f := range closeFiles {
-		err = f.Close()
-		if err != nil {
-			return
+		if cerr := f.Close(); cerr != nil && err == nil {
+			err = cerr
 		}
 	}
 	for _, f := range removeTempFiles {
-		err = os.Remove(f.Name())
-		if err != nil {
-			return
+		// Later stages may have moved or removed the temporary file
+		if rerr := os.Remove(f.Name()); rerr != nil && !os.IsNotExist(rerr) && err == nil {
+			err = rerr
+		}
+	}
+	return input, err
+}
+
+// RunInto executes the pipeline in the same way as Run, but writes the
+// final result to the provided writer, the final result must therefore be
+// a string or []byte.
+func RunInto(result io.Writer, progress io.Writer, stages ...StageFn) error {
+	output, err := Run(progress, stages...)
+	if err != nil {
+		return err
+	}
+	content, err := contentOf(output)
+	if err != nil {
+		return fmt.Errorf("final result of pipeline: %s", err)
+	}
+	_, err = result.Write(content)
+	return err
+}
+
+// PipelineError is returned by Run when a stage fails, it describes the
+// failing stage by its zero based index and function name, and holds the
+// output of the last stage that succeeded.
+type PipelineError struct {
+	StageIndex int
+	Stage      string
+	LastValue  interface{}
+	Err        error
+}
+
+// Error returns the error of the failing stage
+func (e *PipelineError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the error of the failing stage
+func (e *PipelineError) Unwrap() error {
+	return e.Err
+}
+
+// TypeError is returned by ExpectType when the output of the previous stage
+// has an unexpected type
+type TypeError struct {
+	Expected reflect.Type
+	Actual   reflect.Type
+}
+
+// Error describes the expected and the actual type
+func (e *TypeError) Error() string {
+	return fmt.Sprintf("unexpected type: %v, expected: %v", e.Actual, e.Expected)
+}
+
+// ExpectType fails with a *TypeError unless the output of the previous stage
+// is of type t, and passes it on unchanged otherwise. As the last stage, it
+// guarantees the type of the result of Run, so that a mistake in the
+// construction of the pipeline is reported instead of failing a type
+// assertion of the caller, e.g., ExpectType(reflect.TypeOf([]byte(nil))).
+func ExpectType(t reflect.Type) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		if actual := reflect.TypeOf(input); actual != t {
+			return nil, &TypeError{Expected: t, Actual: actual}
 		}
+		return input, nil
 	}
-	return
+}
+
+// Into assigns the output of the previous stage to the value target points
+// to, e.g., var out []byte; Run(nil, Exec("date"), Into(&out)), instead of
+// asserting the type of the result of Run. The output must be assignable to
+// the value, or be a string or []byte for a string or []byte value. A map,
+// slice or struct output is converted to a map, slice or struct value by a
+// JSON round trip, e.g., a map[string]interface{} into a struct. Anything
+// else fails with a *TypeError. The output is passed on unchanged.
+func Into(target interface{}) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		ptr := reflect.ValueOf(target)
+		if ptr.Kind() != reflect.Ptr || ptr.IsNil() {
+			return nil, fmt.Errorf("target must be a non-nil pointer, got: %T", target)
+		}
+		v := ptr.Elem()
+		if input == nil {
+			v.Set(reflect.Zero(v.Type()))
+			return input, nil
+		}
+
+		in := reflect.ValueOf(input)
+		switch {
+		case in.Type().AssignableTo(v.Type()):
+			v.Set(in)
+		case isContent(in.Type()) && isContent(v.Type()):
+			v.Set(in.Convert(v.Type()))
+		case isComposite(in.Kind()) && isComposite(v.Kind()):
+			content, err := json.Marshal(input)
+			if err != nil {
+				return nil, err
+			}
+			if err := json.Unmarshal(content, target); err != nil {
+				return nil, fmt.Errorf("%w: %s", &TypeError{Expected: v.Type(), Actual: in.Type()}, err)
+			}
+		default:
+			return nil, &TypeError{Expected: v.Type(), Actual: in.Type()}
+		}
+		return input, nil
+	}
+}
+
+// isContent reports whether the type is string or []byte
+func isContent(t reflect.Type) bool {
+	return t.Kind() == reflect.String || (t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8)
+}
+
+// isComposite reports whether values of the kind can be converted by a JSON
+// round trip
+func isComposite(k reflect.Kind) bool {
+	return k == reflect.Map || k == reflect.Slice || k == reflect.Struct || k == reflect.Ptr
+}
+
+// stageName strips the package path from the function name of a stage,
+// e.g., do.Exec.func1
+func stageName(fnName string) string {
+	return fnName[strings.LastIndex(fnName, "/")+1:]
 }
 
 type save struct {
@@ -88,13 +322,9 @@ type save struct {
 // provided input of the previous stage.
 func SaveInVar(varName string) StageFn {
 	return func(input interface{}, progress io.Writer) (output interface{}, err error) {
-		valid, err := regexp.Match("^[a-zA-Z]+$", []byte(varName))
-		if err != nil {
+		if err := validateVarName(varName); err != nil {
 			return nil, err
 		}
-		if varName == "content" || varName == "file" || !valid {
-			return nil, fmt.Errorf("not a valid variable name, must match: [a-zA-Z] (excluding: content, file)")
-		}
 		return save{
 			Var: varName,
 			Val: input,
@@ -102,6 +332,92 @@ func SaveInVar(varName string) StageFn {
 	}
 }
 
+func validateVarName(varName string) error {
+	valid, err := regexp.Match("^[a-zA-Z]+$", []byte(varName))
+	if err != nil {
+		return err
+	}
+	if varName == "content" || varName == "file" || !valid {
+		return fmt.Errorf("not a valid variable name, must match: [a-zA-Z] (excluding: content, file)")
+	}
+	return nil
+}
+
+// EnvOption configures SaveEnvVar
+type EnvOption func(*envLookup)
+
+type envLookup struct {
+	defaultValue *string
+}
+
+// EnvDefault saves the provided value when the environment variable is unset
+func EnvDefault(value string) EnvOption {
+	return func(e *envLookup) {
+		e.defaultValue = &value
+	}
+}
+
+// SaveEnvVar saves the value of the environment variable envName as string
+// in the variable varName, in the same way as SaveInVar. The stage fails
+// when the environment variable is unset, unless EnvDefault is provided.
+func SaveEnvVar(envName, varName string, opts ...EnvOption) StageFn {
+	return func(_ interface{}, progress io.Writer) (interface{}, error) {
+		if err := validateVarName(varName); err != nil {
+			return nil, err
+		}
+		lookup := &envLookup{}
+		for _, opt := range opts {
+			opt(lookup)
+		}
+		value, ok := os.LookupEnv(envName)
+		if !ok {
+			if lookup.defaultValue == nil {
+				return nil, fmt.Errorf("environment variable: %s is not set", envName)
+			}
+			value = *lookup.defaultValue
+		}
+		return save{
+			Var: varName,
+			Val: value,
+		}, nil
+	}
+}
+
+// TransformVars provides fn with the variables of the pipeline, which it may
+// modify, e.g., to combine two saved values into a third, and passes the
+// input of the previous stage on unchanged, unless fn returns an error.
+func TransformVars(fn func(vars map[string]interface{}) error) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		data, ok := input.(interceptExec)
+		if !ok {
+			// Should never reach this point
+			return nil, fmt.Errorf("transform vars stage wasn't intercepted")
+		}
+		if err := fn(data.Vars); err != nil {
+			return nil, err
+		}
+		return data.Input, nil
+	}
+}
+
+// RequireEnv fails the pipeline when any of the environment variables is
+// unset or empty, listing all of them, and passes the input of the previous
+// stage on unchanged otherwise.
+func RequireEnv(names ...string) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		var missing []string
+		for _, name := range names {
+			if os.Getenv(name) == "" {
+				missing = append(missing, name)
+			}
+		}
+		if len(missing) > 0 {
+			return nil, fmt.Errorf("required environment variables are not set: %s", strings.Join(missing, ", "))
+		}
+		return input, nil
+	}
+}
+
 // MarshalJSON will serialise the input struct as JSON
 func MarshalJSON(input interface{}, progress io.Writer) (interface{}, error) {
 	ReportProgress(progress, "Marshalling provided content as JSON")
@@ -238,12 +554,98 @@ func Insert(val interface{}) StageFn {
 	}
 }
 
+// contentOf returns the raw bytes of string or []byte input
+func contentOf(input interface{}) ([]byte, error) {
+	switch data := input.(type) {
+	case string:
+		return []byte(data), nil
+	case []byte:
+		return data, nil
+	default:
+		return nil, fmt.Errorf("provided input must be string or []byte")
+	}
+}
+
+// readerOf returns a reader for string, []byte or *os.File input, files are
+// reopened by name as the handler in the pipeline may already be closed
+func readerOf(input interface{}) (io.ReadCloser, error) {
+	switch data := input.(type) {
+	case string:
+		return ioutil.NopCloser(strings.NewReader(data)), nil
+	case []byte:
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	case *os.File:
+		return os.Open(data.Name())
+	default:
+		return nil, fmt.Errorf("provided input must be string, []byte or *os.File")
+	}
+}
+
 type interceptExec struct {
 	Input interface{}
 	Vars  map[string]interface{}
+	Ctx   context.Context
+}
+
+// closureSuffix matches the suffix the compiler adds to the name of the
+// closure returned by a stage function, e.g. Exec.func1, or Exec.1 when
+// the stage function was inlined
+var closureSuffix = regexp.MustCompile(`(\.func\d+|\.\d+)+$`)
+
+// isIntercepted reports whether Run must provide the stage, by its function
+// name, with an interceptExec input. Each intercepted stage is listed, and
+// the name must match exactly, so that a stage with a similar name isn't
+// intercepted by accident. Stages wrapping other stages are intercepted as
+// well, so that they can pass it on to an Exec stage.
+func isIntercepted(fnName string) bool {
+	fnName = closureSuffix.ReplaceAllString(fnName, "")
+	for _, fn := range []interface{}{
+		Exec, ExecRetryOn, ExecTimed, ExecStdinFile, ExecStrict, ExecQuiet, ExecJSON, ExecSave,
+		Interpolate, ExpandVars, Safe, Deadline, ForEach, ForEachAppend, Fork, WithFileLock,
+		WaitForPort, Truncate, remove, Move, WithContext, SkipIfExists, Cache, RateLimit, Race,
+		TransformVars, Checkpoint, Resume, PostWebhook, PipeTimeout, PushMetrics, HTTPStream,
+		SetOp, Once,
+	} {
+		if fnName == runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name() {
+			return true
+		}
+	}
+	return false
+}
+
+// inputFor unwraps the interceptExec input, unless the stage must be
+// provided with it
+func inputFor(stage StageFn, input interface{}) interface{} {
+	if data, ok := input.(interceptExec); ok && !isIntercepted(runtime.FuncForPC(reflect.ValueOf(stage).Pointer()).Name()) {
+		return data.Input
+	}
+	return input
+}
+
+// copyVars copies the variables for use in a sub-pipeline, so that it
+// doesn't affect the variables of the outer pipeline
+func copyVars(vars map[string]interface{}) map[string]interface{} {
+	c := map[string]interface{}{}
+	for k, v := range vars {
+		c[k] = v
+	}
+	return c
+}
+
+// contextOf returns the context of the pipeline for intercepted stages
+func contextOf(input interface{}) context.Context {
+	if data, ok := input.(interceptExec); ok && data.Ctx != nil {
+		return data.Ctx
+	}
+	return context.Background()
 }
 
 func replaceVar(cmd, varName string, with interface{}) (string, error) {
+	placeholder := fmt.Sprintf("#{%s}", varName)
+	if !strings.Contains(cmd, placeholder) {
+		// Only the variables that are referenced must be replaceable
+		return cmd, nil
+	}
 	var content string
 	switch data := with.(type) {
 	case []byte:
@@ -255,7 +657,33 @@ func replaceVar(cmd, varName string, with interface{}) (string, error) {
 	default:
 		return "", fmt.Errorf("don't know how to replace content, required: string, []byte or *os.File")
 	}
-	return strings.Replace(cmd, fmt.Sprintf("#{%s}", varName), content, -1), nil
+	return strings.Replace(cmd, placeholder, content, -1), nil
+}
+
+// InterpolateString replaces the #{content} placeholder with the input if it
+// is a string or []byte, the #{file} placeholder with the name of the input
+// if it is an *os.File, and each #{name} placeholder with the variable of
+// that name. This is what Exec does for its command, so that custom stages
+// can resolve placeholders in the same way. Placeholders without a value are
+// left as is. A referenced variable must be a string, []byte or *os.File,
+// other variables may be of any type.
+func InterpolateString(s string, input interface{}, vars map[string]interface{}) (string, error) {
+	switch d := input.(type) {
+	case []byte:
+		s = strings.Replace(s, "#{content}", string(d), -1)
+	case string:
+		s = strings.Replace(s, "#{content}", d, -1)
+	case *os.File:
+		s = strings.Replace(s, "#{file}", d.Name(), -1)
+	}
+	for varName, i := range vars {
+		var err error
+		s, err = replaceVar(s, varName, i)
+		if err != nil {
+			return "", err
+		}
+	}
+	return s, nil
 }
 
 // Exec runs a command given the provided input, if the previous stage
@@ -265,78 +693,62 @@ func replaceVar(cmd, varName string, with interface{}) (string, error) {
 // the #{content} placeholder.
 func Exec(cmd string) StageFn {
 	return func(input interface{}, progress io.Writer) (output interface{}, err error) {
-		switch data := input.(type) {
-		case interceptExec:
-			switch d := data.Input.(type) {
-			case []byte:
-				cmd = strings.Replace(cmd, "#{content}", string(d), -1)
-			case string:
-				cmd = strings.Replace(cmd, "#{content}", d, -1)
-			case *os.File:
-				cmd = strings.Replace(cmd, "#{file}", d.Name(), -1)
-			}
-			for varName, i := range data.Vars {
-				cmd, err = replaceVar(cmd, varName, i)
-				if err != nil {
-					return nil, err
-				}
-			}
-		default:
-			// Should never reach this point
-			return nil, fmt.Errorf("exec command wasn't intercepted")
+		stdout, _, err := execute(cmd, nil, input, progress)
+		if err != nil {
+			return nil, err
 		}
-		ReportProgress(progress, fmt.Sprintf("Executing command: %s", cmd))
-		return doExecute(progress, cmd)
+		return stdout, nil
 	}
 }
 
-func doExecute(progress io.Writer, command string) (interface{}, error) {
-	var errOut, errErr error
-
-	wd, err := os.Getwd()
-	if err != nil {
-		return nil, err
-	}
-
-	//FIXME: should resolve shell
-	cmd := exec.Command("bash", "-c", command)
-	cmd.Dir = wd
-	stdoutIn, err := cmd.StdoutPipe()
-	if err != nil {
-		return nil, err
+// execute substitutes the placeholders into the command, and runs it with
+// the provided stdin, which may be nil. The stdout and stderr of the command
+// are returned.
+func execute(cmd string, stdin io.Reader, input interface{}, progress io.Writer) (stdout, stderr []byte, err error) {
+	data, ok := input.(interceptExec)
+	if !ok {
+		// Should never reach this point
+		return nil, nil, fmt.Errorf("exec command wasn't intercepted")
 	}
-	stderrIn, err := cmd.StderrPipe()
+	cmd, err = InterpolateString(cmd, data.Input, data.Vars)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	ReportProgress(progress, fmt.Sprintf("Executing command: %s", cmd))
+	return doExecute(contextOf(data), progress, cmd, stdin)
+}
 
-	var errBuff, outBuff bytes.Buffer
-	stdout := io.MultiWriter(progress, &outBuff)
-	stderr := io.MultiWriter(progress, &errBuff)
-
-	err = cmd.Start()
+func doExecute(ctx context.Context, progress io.Writer, command string, stdin io.Reader) ([]byte, []byte, error) {
+	wd, err := os.Getwd()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	go func() {
-		_, errOut = io.Copy(stdout, stdoutIn)
-	}()
-
-	go func() {
-		_, errErr = io.Copy(stderr, stderrIn)
-	}()
-
-	err = cmd.Wait()
+	//FIXME: should resolve shell
+	cmd := exec.CommandContext(ctx, "bash", "-c", command)
+	cmd.Dir = wd
+	// Processes started by the command may keep the output open after it
+	// has been cancelled, don't wait on them indefinitely
+	cmd.WaitDelay = execWaitDelay
+
+	// Forward whole lines, so the output doesn't interleave with other
+	// writers of the progress
+	stdout := &lineWriter{w: progress}
+	stderr := &lineWriter{w: progress}
+
+	var outBuff, errBuff bytes.Buffer
+	cmd.Stdout = io.MultiWriter(stdout, &outBuff)
+	cmd.Stderr = io.MultiWriter(stderr, &errBuff)
+	cmd.Stdin = stdin
+
+	err = cmd.Run()
+	_ = stdout.Flush()
+	_ = stderr.Flush()
 	if err != nil {
-		return nil, err
-	}
-
-	if errOut != nil || errErr != nil {
-		return nil, err
+		return nil, errBuff.Bytes(), err
 	}
 
-	return outBuff.Bytes(), nil
+	return outBuff.Bytes(), errBuff.Bytes(), nil
 }
 
 // ExcludeLines will remove any lines in the input data containing
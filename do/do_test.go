@@ -1,12 +1,20 @@
 package do
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"path"
+	"reflect"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -198,3 +206,290 @@ func TestRun(t *testing.T) {
 		}
 	}
 }
+
+func TestExecOutputComplete(t *testing.T) {
+	// The output must be read completely before the command is waited on,
+	// otherwise it is intermittently truncated
+	expect, err := exec.Command("bash", "-c", "seq 1 20000").Output()
+	assert.Nil(t, err)
+	for i := 0; i < 20; i++ {
+		got, err := Run(nil, Exec("seq 1 20000"))
+		assert.Nil(t, err)
+		assert.Equal(t, expect, got)
+	}
+}
+
+func TestRunCleanupErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	assert.Nil(t, err)
+	name := path.Join(dir, "file")
+	assert.Nil(t, ioutil.WriteFile(name, []byte("hello"), 0644))
+
+	// The error of a failing stage isn't cleared by a successful cleanup
+	_, err = Run(nil, LoadFileHandler(name, os.O_RDONLY, 0), Exec("exit 2"))
+	assert.Equal(t, "exit status 2", err.Error())
+
+	// Closing the file handler of the pipeline again fails its cleanup
+	closeFile := func(input interface{}, _ io.Writer) (interface{}, error) {
+		return input, input.(*os.File).Close()
+	}
+
+	_, err = Run(nil, LoadFileHandler(name, os.O_RDONLY, 0), closeFile)
+	assert.Equal(t, fmt.Sprintf("close %s: file already closed", name), err.Error())
+
+	// The error of a failing stage isn't masked by a failing cleanup
+	_, err = Run(nil, LoadFileHandler(name, os.O_RDONLY, 0), closeFile, Exec("exit 2"))
+	assert.Equal(t, "exit status 2", err.Error())
+}
+
+func TestIsIntercepted(t *testing.T) {
+	for _, stage := range []StageFn{
+		Exec("true"), ExecTimed("true"), ExecStrict("true"), ExecQuiet("true"),
+		ExecSave("true", "out"), ForEach(nil), ForEachAppend("file"), Remove("file"),
+	} {
+		name := runtime.FuncForPC(reflect.ValueOf(stage).Pointer()).Name()
+		assert.True(t, isIntercepted(name), name)
+	}
+
+	assert.True(t, isIntercepted("github.com/paulbes/go-do/do.Exec.1"), "inlined stage")
+	for _, name := range []string{
+		"github.com/paulbes/go-do/do.InterpolateString",
+		"github.com/paulbes/go-do/do.ExecuteLater.func1",
+		"github.com/other/tasks.Exec.func1",
+		"github.com/paulbes/go-do/do.TestIsIntercepted.func1",
+	} {
+		assert.False(t, isIntercepted(name), name)
+	}
+}
+
+func TestRunInto(t *testing.T) {
+	var buf bytes.Buffer
+	err := RunInto(&buf, nil, Exec(`echo -n "hello there"`))
+	assert.Nil(t, err)
+	assert.Equal(t, "hello there", buf.String())
+
+	buf.Reset()
+	err = RunInto(&buf, nil, Insert(42))
+	assert.Equal(t, "final result of pipeline: provided input must be string or []byte", err.Error())
+	assert.Equal(t, "", buf.String())
+
+	err = RunInto(&buf, nil, Exec("exit 1"))
+	assert.Equal(t, "exit status 1", err.Error())
+}
+
+func TestRunWithRetry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	assert.Nil(t, err)
+
+	// Fails until the counter file contains two lines
+	counter := path.Join(dir, "counter")
+	var tempFiles []string
+	recordName := func(input interface{}, _ io.Writer) (interface{}, error) {
+		tempFiles = append(tempFiles, input.(*os.File).Name())
+		return input, nil
+	}
+
+	var progress bytes.Buffer
+	got, err := RunWithRetry(3, 0, &progress,
+		Insert("done"),
+		WriteTempFile,
+		recordName,
+		Exec(fmt.Sprintf(`echo >> %s; [ $(wc -l < %s) -ge 2 ] && cat #{file}`, counter, counter)),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("done"), got)
+	assert.Contains(t, progress.String(), "Pipeline failed on attempt 1 of 3: exit status 1")
+	assert.Contains(t, progress.String(), "Retrying pipeline in 0s, attempt 2 of 3")
+	assert.Len(t, tempFiles, 2)
+	for _, name := range tempFiles {
+		_, err := os.Stat(name)
+		assert.True(t, os.IsNotExist(err), "temporary files of each attempt should be removed")
+	}
+
+	_, err = RunWithRetry(2, 0, nil, Exec("exit 3"))
+	assert.Equal(t, "exit status 3", err.Error())
+
+	_, err = RunWithRetry(0, 0, nil, Exec("exit 3"))
+	assert.Equal(t, "number of attempts must be at least 1, got: 0", err.Error())
+}
+
+func TestRunContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := RunContext(ctx, nil, Insert("hello"), Exec("echo -n hello"))
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Equal(t, "pipeline cancelled before stage 0 (do.Insert.func1): context canceled", err.Error())
+
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = RunContext(ctx, nil, Insert("hello"), Exec("sleep 5"), Exec("echo -n hello"))
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Equal(t, "stage 1 (do.Exec.func1) interrupted: context deadline exceeded", err.Error())
+}
+
+type traceKey struct{}
+
+func TestWithContext(t *testing.T) {
+	ctx := context.WithValue(context.Background(), traceKey{}, "trace-1")
+	got, err := RunContext(ctx, nil,
+		Insert("hello"),
+		WithContext(func(ctx context.Context, input interface{}, _ io.Writer) (interface{}, error) {
+			return fmt.Sprintf("%s %s", input, ctx.Value(traceKey{})), nil
+		}),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, "hello trace-1", got)
+
+	got, err = Run(nil, WithContext(func(ctx context.Context, input interface{}, _ io.Writer) (interface{}, error) {
+		return ctx.Value(traceKey{}), nil
+	}))
+	assert.Nil(t, err)
+	assert.Nil(t, got)
+}
+
+func TestPipelineError(t *testing.T) {
+	got, err := Run(nil, Insert("hello"), Exec(`echo -n "#{content} there"`), Exec("exit 3"))
+	assert.Nil(t, got)
+
+	var pipelineErr *PipelineError
+	assert.True(t, errors.As(err, &pipelineErr))
+	assert.Equal(t, 2, pipelineErr.StageIndex)
+	assert.Equal(t, "do.Exec.func1", pipelineErr.Stage)
+	assert.Equal(t, []byte("hello there"), pipelineErr.LastValue)
+	assert.Equal(t, "exit status 3", pipelineErr.Error())
+
+	_, err = Run(nil, Insert("hello"), SaveInVar("greeting"), Insert("there"), SaveInVar("greeting"))
+	assert.True(t, errors.As(err, &pipelineErr))
+	assert.Equal(t, 3, pipelineErr.StageIndex)
+	assert.Equal(t, "there", pipelineErr.LastValue)
+
+	_, err = Run(nil, Insert("hello"), SaveInVar("greeting"), Exec("exit 1"))
+	assert.True(t, errors.As(err, &pipelineErr))
+	assert.Equal(t, "hello", pipelineErr.LastValue)
+}
+
+func TestInterpolateString(t *testing.T) {
+	got, err := InterpolateString("#{content} #{name} #{file}", []byte("hello"), map[string]interface{}{"name": "bob"})
+	assert.Nil(t, err)
+	assert.Equal(t, "hello bob #{file}", got)
+
+	_, err = InterpolateString("#{answer}", nil, map[string]interface{}{"answer": 42})
+	assert.Equal(t, "don't know how to replace content, required: string, []byte or *os.File", err.Error())
+}
+
+func TestSaveEnvVar(t *testing.T) {
+	assert.Nil(t, os.Setenv("GODO_TEST_GREETING", "hello"))
+	defer func() {
+		_ = os.Unsetenv("GODO_TEST_GREETING")
+	}()
+
+	got, err := Run(nil, SaveEnvVar("GODO_TEST_GREETING", "greeting"), Insert(nil), Exec(`echo -n "#{greeting}"`))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("hello"), got)
+
+	got, err = Run(nil, SaveEnvVar("GODO_TEST_MISSING", "name", EnvDefault("bob")), Insert(nil), Exec(`echo -n "#{name}"`))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("bob"), got)
+
+	_, err = Run(nil, SaveEnvVar("GODO_TEST_MISSING", "name"))
+	assert.Equal(t, "environment variable: GODO_TEST_MISSING is not set", err.Error())
+
+	_, err = Run(nil, SaveEnvVar("GODO_TEST_GREETING", "file"))
+	assert.Equal(t, "not a valid variable name, must match: [a-zA-Z] (excluding: content, file)", err.Error())
+}
+
+func TestRequireEnv(t *testing.T) {
+	assert.Nil(t, os.Setenv("GODO_TEST_SET", "value"))
+	assert.Nil(t, os.Setenv("GODO_TEST_EMPTY", ""))
+	defer func() {
+		_ = os.Unsetenv("GODO_TEST_SET")
+		_ = os.Unsetenv("GODO_TEST_EMPTY")
+	}()
+
+	got, err := Run(nil, Insert("hello"), RequireEnv("GODO_TEST_SET"))
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", got)
+
+	_, err = Run(nil, RequireEnv("GODO_TEST_MISSING", "GODO_TEST_SET", "GODO_TEST_EMPTY"))
+	assert.Equal(t, "required environment variables are not set: GODO_TEST_MISSING, GODO_TEST_EMPTY", err.Error())
+}
+
+func TestExpectType(t *testing.T) {
+	got, err := Run(nil, Exec("echo -n hello"), ExpectType(reflect.TypeOf([]byte(nil))))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("hello"), got)
+
+	_, err = Run(nil, Insert("hello"), ExpectType(reflect.TypeOf([]byte(nil))))
+	var typeErr *TypeError
+	assert.True(t, errors.As(err, &typeErr))
+	assert.Equal(t, reflect.TypeOf(""), typeErr.Actual)
+	assert.Equal(t, "unexpected type: string, expected: []uint8", err.Error())
+
+	_, err = Run(nil, Insert(nil), ExpectType(reflect.TypeOf(&Test{})))
+	assert.Equal(t, "unexpected type: <nil>, expected: *do.Test", err.Error())
+}
+
+func TestInto(t *testing.T) {
+	var out []byte
+	got, err := Run(nil, Exec("echo -n hello"), Into(&out))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("hello"), out)
+	assert.Equal(t, []byte("hello"), got)
+
+	var s string
+	_, err = Run(nil, Exec("echo -n hello"), Into(&s))
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", s)
+
+	var test Test
+	_, err = Run(nil, Insert(map[string]interface{}{"name": "bob"}), Into(&test))
+	assert.Nil(t, err)
+	assert.Equal(t, Test{Name: "bob"}, test)
+
+	var names []string
+	_, err = Run(nil, Insert([]interface{}{"bob", "alice"}), Into(&names))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"bob", "alice"}, names)
+
+	var n int
+	_, err = Run(nil, Insert("42"), Into(&n))
+	var typeErr *TypeError
+	assert.True(t, errors.As(err, &typeErr))
+	assert.Equal(t, "unexpected type: string, expected: int", err.Error())
+
+	_, err = Run(nil, Insert([]interface{}{1}), Into(&names))
+	assert.True(t, errors.As(err, &typeErr))
+	assert.True(t, strings.HasPrefix(err.Error(), "unexpected type: []interface {}, expected: []string: json: cannot unmarshal number"))
+
+	_, err = Run(nil, Insert("hello"), Into(s))
+	assert.Equal(t, "target must be a non-nil pointer, got: string", err.Error())
+}
+
+func TestTransformVars(t *testing.T) {
+	got, err := Run(nil,
+		Insert("bob"),
+		SaveInVar("first"),
+		Insert("smith"),
+		SaveInVar("last"),
+		Insert("names"),
+		TransformVars(func(vars map[string]interface{}) error {
+			vars["full"] = fmt.Sprintf("%s %s", vars["first"], vars["last"])
+			delete(vars, "first")
+			return nil
+		}),
+		Exec(`echo -n "#{content}: #{full} #{first}"`),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("names: bob smith #{first}"), got)
+
+	_, err = Run(nil, TransformVars(func(vars map[string]interface{}) error {
+		return fmt.Errorf("missing variable")
+	}))
+	assert.Equal(t, "missing variable", err.Error())
+}
@@ -0,0 +1,215 @@
+package do
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// exitCode returns the exit code of a command that ran to completion but
+// failed
+func exitCode(err error) (int, bool) {
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return exitErr.ExitCode(), true
+	}
+	return 0, false
+}
+
+// ExecRetryOn runs the command in the same way as Exec, but retries it when
+// the command exits with one of the provided exit codes, for up to the
+// given number of attempts in total, waiting backoff between each attempt.
+// Any other failure is returned immediately.
+func ExecRetryOn(cmd string, codes []int, attempts int, backoff time.Duration) StageFn {
+	return func(input interface{}, progress io.Writer) (output interface{}, err error) {
+		if attempts < 1 {
+			return nil, fmt.Errorf("number of attempts must be at least 1, got: %d", attempts)
+		}
+		for attempt := 1; attempt <= attempts; attempt++ {
+			if attempt > 1 {
+				ReportProgress(progress, "Retrying command in %s, attempt %d of %d", backoff, attempt, attempts)
+				select {
+				case <-time.After(backoff):
+				case <-contextOf(input).Done():
+					return nil, contextOf(input).Err()
+				}
+			}
+			// Run intercepts this stage like Exec, so the input is
+			// handed on to Exec as is
+			output, err = Exec(cmd)(input, progress)
+			if err == nil {
+				return output, nil
+			}
+			code, ok := exitCode(err)
+			if !ok || !containsInt(codes, code) {
+				return output, err
+			}
+		}
+		return output, err
+	}
+}
+
+// TimedOutput is the result of the ExecTimed stage
+type TimedOutput struct {
+	Output   []byte
+	Duration time.Duration
+}
+
+// ExecTimed runs the command in the same way as Exec and returns its output
+// together with the time it took to run, as TimedOutput
+func ExecTimed(cmd string) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		// Run intercepts this stage like Exec, so the input is handed on
+		// to Exec as is
+		start := time.Now()
+		output, err := Exec(cmd)(input, progress)
+		duration := time.Since(start)
+		if err != nil {
+			return nil, err
+		}
+		ReportProgress(progress, "Command completed in: %s", duration)
+		return TimedOutput{
+			Output:   output.([]byte),
+			Duration: duration,
+		}, nil
+	}
+}
+
+// ExecStdinFile runs the command in the same way as Exec, with the content of
+// the *os.File saved in the variable fileVar streamed to its stdin
+func ExecStdinFile(cmd string, fileVar string) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		data, ok := input.(interceptExec)
+		if !ok {
+			// Should never reach this point
+			return nil, fmt.Errorf("exec command wasn't intercepted")
+		}
+		v, ok := data.Vars[fileVar]
+		if !ok {
+			return nil, fmt.Errorf("variable: %s doesn't exist", fileVar)
+		}
+		file, ok := v.(*os.File)
+		if !ok {
+			return nil, fmt.Errorf("variable: %s must be an *os.File", fileVar)
+		}
+		// Reopen the file, so its offset is independent of other stages
+		stdin, err := os.Open(file.Name())
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			_ = stdin.Close()
+		}()
+		stdout, _, err := execute(cmd, stdin, input, progress)
+		if err != nil {
+			return nil, err
+		}
+		return stdout, nil
+	}
+}
+
+// ExecStrict runs the command in the same way as Exec, but also fails when
+// the command writes anything to stderr, even if it exits with zero. The
+// error contains what was written to stderr.
+func ExecStrict(cmd string) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		stdout, stderr, err := execute(cmd, nil, input, progress)
+		if err != nil {
+			return nil, err
+		}
+		if len(stderr) > 0 {
+			return nil, fmt.Errorf("command wrote to stderr: %s", strings.TrimSpace(string(stderr)))
+		}
+		return stdout, nil
+	}
+}
+
+// ExecQuiet runs the command in the same way as Exec, but doesn't write its
+// output to the progress while it runs. The output is buffered instead, and
+// only written to the progress when the command fails.
+func ExecQuiet(cmd string) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		var buf bytes.Buffer
+		stdout, _, err := execute(cmd, nil, input, synchronised(&buf))
+		if err != nil {
+			if progress != nil {
+				_, _ = progress.Write(buf.Bytes())
+			}
+			return nil, err
+		}
+		return stdout, nil
+	}
+}
+
+// ExecJSON runs the command in the same way as Exec, and unmarshals its
+// output as JSON into to, which is returned. When the command fails, or its
+// output isn't valid JSON, the error includes what the command wrote to
+// stderr.
+func ExecJSON(cmd string, to interface{}) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		stdout, stderr, err := execute(cmd, nil, input, progress)
+		if err == nil {
+			err = json.Unmarshal(stdout, to)
+		}
+		if err != nil {
+			if msg := strings.TrimSpace(string(stderr)); msg != "" {
+				return nil, fmt.Errorf("%w, stderr: %s", err, msg)
+			}
+			return nil, err
+		}
+		return to, nil
+	}
+}
+
+// RequireCommand fails the pipeline when any of the commands can't be found
+// in the PATH, and passes the input of the previous stage on unchanged
+// otherwise. As a preflight check before Exec stages, this reports a missing
+// tool more clearly than the exit status 127 of the shell.
+func RequireCommand(names ...string) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		for _, name := range names {
+			if _, err := exec.LookPath(name); err != nil {
+				return nil, fmt.Errorf("command not found: %s; is it installed?", name)
+			}
+		}
+		return input, nil
+	}
+}
+
+// ExecSave runs the command in the same way as Exec, and saves its output
+// in the variable varName, in the same way as SaveInVar, while also passing
+// it on to the next stage.
+func ExecSave(cmd, varName string) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		data, ok := input.(interceptExec)
+		if !ok {
+			// Should never reach this point
+			return nil, fmt.Errorf("exec command wasn't intercepted")
+		}
+		if err := validateVarName(varName); err != nil {
+			return nil, err
+		}
+		if _, hasKey := data.Vars[varName]; hasKey {
+			return nil, fmt.Errorf("variable: %s already exists", varName)
+		}
+		stdout, _, err := execute(cmd, nil, input, progress)
+		if err != nil {
+			return nil, err
+		}
+		data.Vars[varName] = stdout
+		return stdout, nil
+	}
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,212 @@
+package do
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExec(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	assert.Nil(t, err)
+
+	// Fails with exit code 3 until the counter file contains two lines
+	counter := path.Join(dir, "counter")
+	flaky := fmt.Sprintf(`echo >> %s; [ $(wc -l < %s) -ge 2 ] || exit 3; echo -n "#{content}"`, counter, counter)
+
+	testCases := []struct {
+		name        string
+		stages      []StageFn
+		expect      interface{}
+		expectError bool
+	}{
+		{
+			name: "exec retry on",
+			stages: []StageFn{
+				Insert("done"),
+				ExecRetryOn(flaky, []int{3}, 3, 0),
+			},
+			expect:      []byte("done"),
+			expectError: false,
+		},
+		{
+			name: "exec retry on other exit code",
+			stages: []StageFn{
+				ExecRetryOn("exit 127", []int{3}, 3, 0),
+			},
+			expect:      fmt.Errorf("exit status 127"),
+			expectError: true,
+		},
+		{
+			name: "exec strict",
+			stages: []StageFn{
+				Insert("hello"),
+				ExecStrict(`echo -n "#{content}"`),
+			},
+			expect:      []byte("hello"),
+			expectError: false,
+		},
+		{
+			name: "exec strict stderr",
+			stages: []StageFn{
+				ExecStrict(`echo -n out && echo "warning: deprecated" >&2`),
+			},
+			expect:      fmt.Errorf("command wrote to stderr: warning: deprecated"),
+			expectError: true,
+		},
+		{
+			name: "exec strict exit code",
+			stages: []StageFn{
+				ExecStrict(`echo oops >&2; exit 4`),
+			},
+			expect:      fmt.Errorf("exit status 4"),
+			expectError: true,
+		},
+		{
+			name: "exec JSON",
+			stages: []StageFn{
+				Insert("bob"),
+				ExecJSON(`echo '{"name": "#{content}"}'`, &Test{}),
+			},
+			expect:      &Test{Name: "bob"},
+			expectError: false,
+		},
+		{
+			name: "exec JSON failure",
+			stages: []StageFn{
+				ExecJSON(`echo "no such tool" >&2 && exit 127`, &Test{}),
+			},
+			expect:      fmt.Errorf("exit status 127, stderr: no such tool"),
+			expectError: true,
+		},
+		{
+			name: "exec JSON invalid output",
+			stages: []StageFn{
+				ExecJSON(`echo "warning: deprecated" >&2 && echo -n "name: bob"`, &Test{}),
+			},
+			expect:      fmt.Errorf("invalid character 'a' in literal null (expecting 'u'), stderr: warning: deprecated"),
+			expectError: true,
+		},
+		{
+			name: "require command",
+			stages: []StageFn{
+				Insert("hello"),
+				RequireCommand("bash", "cat"),
+			},
+			expect:      "hello",
+			expectError: false,
+		},
+		{
+			name: "require missing command",
+			stages: []StageFn{
+				RequireCommand("cat", "godo-missing-command"),
+			},
+			expect:      fmt.Errorf("command not found: godo-missing-command; is it installed?"),
+			expectError: true,
+		},
+		{
+			name: "exec save",
+			stages: []StageFn{
+				ExecSave("echo -n hello", "greeting"),
+				Exec(`echo -n "#{content} #{greeting}"`),
+			},
+			expect:      []byte("hello hello"),
+			expectError: false,
+		},
+		{
+			name: "exec save invalid var",
+			stages: []StageFn{
+				ExecSave("echo -n hello", "content"),
+			},
+			expect:      fmt.Errorf("not a valid variable name, must match: [a-zA-Z] (excluding: content, file)"),
+			expectError: true,
+		},
+		{
+			name: "exec save existing var",
+			stages: []StageFn{
+				ExecSave("echo -n hello", "greeting"),
+				ExecSave("echo -n again", "greeting"),
+			},
+			expect:      fmt.Errorf("variable: greeting already exists"),
+			expectError: true,
+		},
+		{
+			name: "exec retry on exhausted",
+			stages: []StageFn{
+				ExecRetryOn("exit 3", []int{3}, 2, 0),
+			},
+			expect:      fmt.Errorf("exit status 3"),
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		got, err := Run(nil, tc.stages...)
+		if tc.expectError {
+			assert.Equal(t, tc.expect.(error).Error(), err.Error(), tc.name)
+		} else {
+			assert.Equal(t, tc.expect, got, tc.name)
+			assert.Nil(t, err, tc.name)
+		}
+	}
+}
+
+func TestExecTimed(t *testing.T) {
+	got, err := Run(nil, Insert("hello"), ExecTimed(`sleep 0.1 && echo -n "#{content}"`))
+	assert.Nil(t, err)
+	timed := got.(TimedOutput)
+	assert.Equal(t, []byte("hello"), timed.Output)
+	assert.True(t, timed.Duration >= 100*time.Millisecond)
+
+	_, err = Run(nil, ExecTimed("exit 2"))
+	assert.Equal(t, "exit status 2", err.Error())
+
+	// A saved timing doesn't break later stages that don't reference it
+	got, err = Run(nil, ExecTimed("echo -n hi"), SaveInVar("timing"), Insert("x"), Exec("echo -n ok"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("ok"), got)
+
+	_, err = Run(nil, ExecTimed("echo -n hi"), SaveInVar("timing"), Insert("x"), Exec(`echo -n "#{timing}"`))
+	assert.Equal(t, "don't know how to replace content, required: string, []byte or *os.File", err.Error())
+}
+
+func TestExecStdinFile(t *testing.T) {
+	got, err := Run(nil,
+		Insert("hello\nthere\n"),
+		WriteTempFile,
+		SaveInVar("input"),
+		Insert("x"),
+		ExecStdinFile(`tr a-z A-Z && echo -n "#{content}"`, "input"),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("HELLO\nTHERE\nx"), got)
+
+	_, err = Run(nil, ExecStdinFile("cat", "missing"))
+	assert.Equal(t, "variable: missing doesn't exist", err.Error())
+
+	_, err = Run(nil, Insert("hello"), SaveInVar("greeting"), ExecStdinFile("cat", "greeting"))
+	assert.Equal(t, "variable: greeting must be an *os.File", err.Error())
+}
+
+func TestExecQuiet(t *testing.T) {
+	var progress bytes.Buffer
+	got, err := Run(&progress, ExecQuiet(`echo -n out && echo err >&2`))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("out"), got)
+	assert.Equal(t, "", progress.String())
+
+	_, err = Run(&progress, ExecQuiet(`echo out && echo err >&2 && exit 1`))
+	assert.Equal(t, "exit status 1", err.Error())
+	assert.Contains(t, progress.String(), "Executing command: echo out")
+	assert.Contains(t, progress.String(), "out\n")
+	assert.Contains(t, progress.String(), "err\n")
+}
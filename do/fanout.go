@@ -0,0 +1,289 @@
+package do
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+type fanOut struct {
+	concurrency   int
+	collectErrors bool
+	progressBar   bool
+}
+
+// FanOutOption configures how ForEach and Fork execute their sub-pipelines
+type FanOutOption func(f *fanOut)
+
+// Concurrency bounds the number of sub-pipelines executed at the same time,
+// by default they are executed one at a time
+func Concurrency(n int) FanOutOption {
+	return func(f *fanOut) {
+		f.concurrency = n
+	}
+}
+
+// FailFast stops the remaining sub-pipelines as soon as one of them fails,
+// and returns the error of that sub-pipeline, this is the default
+func FailFast(f *fanOut) {
+	f.collectErrors = false
+}
+
+// CollectErrors runs every sub-pipeline regardless of failures, and returns
+// the errors of all failed sub-pipelines joined together, in order. The
+// results of the successful sub-pipelines are returned alongside the error,
+// where failed sub-pipelines have a nil result.
+func CollectErrors(f *fanOut) {
+	f.collectErrors = true
+}
+
+// ProgressBar reports a progress bar, e.g., [########------------] 4/10, to
+// the progress each time a sub-pipeline completes, whether it succeeded or
+// failed
+func ProgressBar(f *fanOut) {
+	f.progressBar = true
+}
+
+// progressBarWidth is the number of characters of the bar of ProgressBar
+const progressBarWidth = 20
+
+// renderProgressBar renders the bar for done out of total sub-pipelines
+func renderProgressBar(done, total int) string {
+	filled := progressBarWidth
+	if total > 0 {
+		filled = done * progressBarWidth / total
+	}
+	return fmt.Sprintf("[%s%s] %d/%d", strings.Repeat("#", filled), strings.Repeat("-", progressBarWidth-filled), done, total)
+}
+
+func newFanOut(opts []FanOutOption) *fanOut {
+	f := &fanOut{concurrency: 1}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+// execute runs each pipeline with its corresponding input, returning the
+// results in the same order. The first failing pipeline cancels the others,
+// unless errors are collected. A panic in a pipeline is returned as its error.
+func (f *fanOut) execute(label string, data interceptExec, progress io.Writer, inputs []interface{}, pipelines [][]StageFn) ([]interface{}, error) {
+	if f.concurrency < 1 {
+		return nil, fmt.Errorf("concurrency must be at least 1, got: %d", f.concurrency)
+	}
+	ctx, cancel := context.WithCancel(contextOf(data))
+	defer cancel()
+
+	results := make([]interface{}, len(inputs))
+	errs := make([]error, len(inputs))
+	sem := make(chan struct{}, f.concurrency)
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	// Completions are counted and reported together, so that the reported
+	// bars only ever grow
+	var completedMu sync.Mutex
+	completed := 0
+
+ToLaunch:
+	for i := range inputs {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			break ToLaunch
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() {
+				<-sem
+			}()
+			out, err := runRecovering(ctx, progress, inputs[i], copyVars(data.Vars), pipelines[i])
+			if f.progressBar {
+				completedMu.Lock()
+				completed++
+				ReportProgress(progress, "%s", renderProgressBar(completed, len(inputs)))
+				completedMu.Unlock()
+			}
+			if err != nil && f.collectErrors {
+				errs[i] = fmt.Errorf("%s %d: %w", label, i, err)
+				return
+			}
+			results[i] = out
+			if err != nil {
+				once.Do(func() {
+					firstErr = fmt.Errorf("%s %d: %w", label, i, err)
+					cancel()
+				})
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := contextOf(data).Err(); err != nil {
+		return nil, err
+	}
+	if err := errors.Join(errs...); err != nil {
+		return results, err
+	}
+	return results, nil
+}
+
+// ForEach runs the stages as a sub-pipeline for each element of the slice
+// input, with a copy of the variables, and returns the results as
+// []interface{} in the order of the input. The first failing sub-pipeline
+// fails the stage, unless CollectErrors is provided, see Concurrency for
+// running sub-pipelines in parallel.
+func ForEach(stages []StageFn, opts ...FanOutOption) StageFn {
+	f := newFanOut(opts)
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		data, ok := input.(interceptExec)
+		if !ok {
+			// Should never reach this point
+			return nil, fmt.Errorf("for each stage wasn't intercepted")
+		}
+		items, err := itemsOf(data.Input)
+		if err != nil {
+			return nil, err
+		}
+		ReportProgress(progress, "Running stages for each of %d items", len(items))
+
+		pipelines := make([][]StageFn, len(items))
+		for i := range pipelines {
+			pipelines[i] = stages
+		}
+		return f.execute("item", data, progress, items, pipelines)
+	}
+}
+
+// ForEachAppend runs the stages as a sub-pipeline for each element of the
+// slice input, one after the other, with a copy of the variables, and
+// appends the result of each, which must be string or []byte, to the file,
+// in the order of the input. The file is created if it doesn't exist, and
+// returned as *os.File. Results are written as they are produced, instead
+// of being collected in memory first.
+func ForEachAppend(file string, stages ...StageFn) StageFn {
+	return func(input interface{}, progress io.Writer) (_ interface{}, err error) {
+		data, ok := input.(interceptExec)
+		if !ok {
+			// Should never reach this point
+			return nil, fmt.Errorf("for each stage wasn't intercepted")
+		}
+		items, err := itemsOf(data.Input)
+		if err != nil {
+			return nil, err
+		}
+
+		f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			if cerr := f.Close(); cerr != nil && err == nil {
+				err = cerr
+			}
+		}()
+
+		for i, item := range items {
+			ReportProgress(progress, "Appending result of item %d of %d to file: %s", i+1, len(items), file)
+			out, err := run(contextOf(data), progress, item, copyVars(data.Vars), stages)
+			if err != nil {
+				return nil, fmt.Errorf("item %d: %w", i, err)
+			}
+			content, err := contentOf(out)
+			if err != nil {
+				return nil, fmt.Errorf("item %d: %w", i, err)
+			}
+			if _, err := f.Write(content); err != nil {
+				return nil, fmt.Errorf("item %d: %w", i, err)
+			}
+		}
+		return os.Open(file)
+	}
+}
+
+// Fork runs each of the branches as a sub-pipeline with the input of the
+// previous stage, and a copy of the variables, returning the result of each
+// branch as []interface{} in the order of the branches. The first failing
+// branch fails the stage, unless CollectErrors is provided, see Concurrency
+// for running branches in parallel.
+func Fork(branches [][]StageFn, opts ...FanOutOption) StageFn {
+	f := newFanOut(opts)
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		data, ok := input.(interceptExec)
+		if !ok {
+			// Should never reach this point
+			return nil, fmt.Errorf("fork stage wasn't intercepted")
+		}
+		ReportProgress(progress, "Forking pipeline into %d branches", len(branches))
+
+		inputs := make([]interface{}, len(branches))
+		for i := range inputs {
+			inputs[i] = data.Input
+		}
+		return f.execute("branch", data, progress, inputs, branches)
+	}
+}
+
+// Race runs all of the branches concurrently as sub-pipelines with the input
+// of the previous stage, and a copy of the variables, and returns the result
+// of the first branch that succeeds, cancelling the others. It doesn't wait
+// for the other branches to stop, a stage that ignores the cancellation
+// finishes in the background. A panicking branch loses the race, with the
+// panic as its error. The stage only fails when all of the branches fail,
+// with the errors of all branches.
+func Race(branches ...[]StageFn) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		data, ok := input.(interceptExec)
+		if !ok {
+			// Should never reach this point
+			return nil, fmt.Errorf("race stage wasn't intercepted")
+		}
+		if len(branches) == 0 {
+			return nil, fmt.Errorf("at least one branch is required")
+		}
+		ReportProgress(progress, "Racing %d branches", len(branches))
+		ctx, cancel := context.WithCancel(contextOf(data))
+		defer cancel()
+
+		type result struct {
+			branch int
+			out    interface{}
+			err    error
+		}
+		results := make(chan result, len(branches))
+		for i, branch := range branches {
+			go func(i int, branch []StageFn) {
+				out, err := runRecovering(ctx, progress, data.Input, copyVars(data.Vars), branch)
+				results <- result{branch: i, out: out, err: err}
+			}(i, branch)
+		}
+
+		errs := make([]error, len(branches))
+		for range branches {
+			r := <-results
+			if r.err != nil {
+				errs[r.branch] = fmt.Errorf("branch %d: %w", r.branch, r.err)
+				continue
+			}
+			// The results channel is buffered, so the losing branches don't
+			// block once they have finished, their results are discarded
+			ReportProgress(progress, "Branch %d won the race", r.branch)
+			return r.out, nil
+		}
+		if err := contextOf(data).Err(); err != nil {
+			return nil, err
+		}
+		return nil, errors.Join(errs...)
+	}
+}
@@ -0,0 +1,248 @@
+package do
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFanOut(t *testing.T) {
+	testCases := []struct {
+		name        string
+		stages      []StageFn
+		expect      interface{}
+		expectError bool
+	}{
+		{
+			name: "for each",
+			stages: []StageFn{
+				Insert("!"),
+				SaveInVar("suffix"),
+				Insert([]string{"a", "b", "c"}),
+				ForEach([]StageFn{Exec(`echo -n "#{content}#{suffix}"`)}),
+			},
+			expect:      []interface{}{[]byte("a!"), []byte("b!"), []byte("c!")},
+			expectError: false,
+		},
+		{
+			name: "for each concurrently in order",
+			stages: []StageFn{
+				Insert([]string{"0.3", "0.2", "0.1", "0"}),
+				ForEach([]StageFn{Exec(`sleep #{content} && echo -n "#{content}"`)}, Concurrency(4)),
+			},
+			expect:      []interface{}{[]byte("0.3"), []byte("0.2"), []byte("0.1"), []byte("0")},
+			expectError: false,
+		},
+		{
+			name: "for each error",
+			stages: []StageFn{
+				Insert([]string{"0", "1", "0"}),
+				ForEach([]StageFn{Exec("exit #{content}")}, Concurrency(2)),
+			},
+			expect:      fmt.Errorf("item 1: exit status 1"),
+			expectError: true,
+		},
+		{
+			name: "for each invalid concurrency",
+			stages: []StageFn{
+				Insert([]string{"a"}),
+				ForEach(nil, Concurrency(0)),
+			},
+			expect:      fmt.Errorf("concurrency must be at least 1, got: 0"),
+			expectError: true,
+		},
+		{
+			name: "fork",
+			stages: []StageFn{
+				Insert(`{"name": "bob"}`),
+				Fork([][]StageFn{
+					{UnmarshalJSON(&Test{}), GetName},
+					{Exec(`echo -n '#{content}' | wc -c | tr -d ' '`)},
+				}, Concurrency(2)),
+			},
+			expect:      []interface{}{"bob", []byte("15\n")},
+			expectError: false,
+		},
+		{
+			name: "fork error",
+			stages: []StageFn{
+				Fork([][]StageFn{
+					{Insert("fine")},
+					{Exec("exit 4")},
+				}),
+			},
+			expect:      fmt.Errorf("branch 1: exit status 4"),
+			expectError: true,
+		},
+		{
+			name: "for each collect errors",
+			stages: []StageFn{
+				Insert([]string{"1", "0", "2"}),
+				ForEach([]StageFn{Exec("exit #{content}")}, Concurrency(3), CollectErrors),
+			},
+			expect:      fmt.Errorf("item 0: exit status 1\nitem 2: exit status 2"),
+			expectError: true,
+		},
+		{
+			name: "for each fail fast",
+			stages: []StageFn{
+				Insert([]string{"1", "0", "2"}),
+				ForEach([]StageFn{Exec("exit #{content}")}, CollectErrors, FailFast),
+			},
+			expect:      fmt.Errorf("item 0: exit status 1"),
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		got, err := Run(nil, tc.stages...)
+		if tc.expectError {
+			assert.Equal(t, tc.expect.(error).Error(), err.Error(), tc.name)
+		} else {
+			assert.Equal(t, tc.expect, got, tc.name)
+			assert.Nil(t, err, tc.name)
+		}
+	}
+
+	got, err := Run(nil,
+		Fork([][]StageFn{
+			{Exec("exit 3")},
+			{Exec("echo -n fine")},
+		}, CollectErrors),
+	)
+	assert.Equal(t, "branch 0: exit status 3", err.Error())
+	assert.Equal(t, []interface{}{nil, []byte("fine")}, got)
+
+	start := time.Now()
+	_, err = Run(nil,
+		Insert([]string{"a", "b", "c", "d"}),
+		ForEach([]StageFn{Exec("sleep 0.3")}, Concurrency(2)),
+	)
+	assert.Nil(t, err)
+	elapsed := time.Since(start)
+	assert.True(t, elapsed >= 600*time.Millisecond, "at most two commands should run at a time")
+	assert.True(t, elapsed < 1200*time.Millisecond, "two commands should run at a time")
+
+	// A panicking sub-pipeline fails its item instead of crashing
+	_, err = Run(nil, Insert([]string{"a"}), ForEach([]StageFn{Panic}))
+	assert.True(t, strings.HasPrefix(err.Error(), "item 0: sub-pipeline panicked: runtime error: invalid memory address or nil pointer dereference\ngoroutine"), err.Error())
+
+	got, err = Run(nil,
+		Fork([][]StageFn{
+			{Panic},
+			{Exec("echo -n fine")},
+		}, Concurrency(2), CollectErrors),
+	)
+	assert.True(t, strings.HasPrefix(err.Error(), "branch 0: sub-pipeline panicked: "), err.Error())
+	assert.Equal(t, []interface{}{nil, []byte("fine")}, got)
+}
+
+func TestProgressBar(t *testing.T) {
+	var progress bytes.Buffer
+	got, err := Run(&progress,
+		Insert([]interface{}{"a", "b", "c", "d"}),
+		ForEach([]StageFn{Exec(`echo -n "#{content}"`)}, Concurrency(2), ProgressBar),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{[]byte("a"), []byte("b"), []byte("c"), []byte("d")}, got)
+
+	var bars []string
+	for _, line := range strings.Split(progress.String(), "\n") {
+		if strings.HasPrefix(line, "[") {
+			bars = append(bars, line)
+		}
+	}
+	assert.Equal(t, []string{
+		"[#####---------------] 1/4",
+		"[##########----------] 2/4",
+		"[###############-----] 3/4",
+		"[####################] 4/4",
+	}, bars)
+	assert.Equal(t, "[####################] 0/0", renderProgressBar(0, 0))
+}
+
+func TestRace(t *testing.T) {
+	start := time.Now()
+	got, err := Run(nil,
+		Insert("hello"),
+		Race(
+			[]StageFn{Exec(`sleep 5 && echo -n "slow #{content}"`)},
+			[]StageFn{Exec("exit 1")},
+			[]StageFn{Exec(`sleep 0.1 && echo -n "fast #{content}"`)},
+		),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("fast hello"), got)
+	assert.True(t, time.Since(start) < 5*time.Second, "losing branches should be cancelled")
+
+	ignoresCancel := func(input interface{}, _ io.Writer) (interface{}, error) {
+		time.Sleep(2 * time.Second)
+		return input, nil
+	}
+	start = time.Now()
+	got, err = Run(nil,
+		Insert("hello"),
+		Race(
+			[]StageFn{ignoresCancel},
+			[]StageFn{Exec(`echo -n "fast #{content}"`)},
+		),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("fast hello"), got)
+	assert.True(t, time.Since(start) < time.Second, "race shouldn't wait for the losing branches")
+
+	got, err = Run(nil, Race(
+		[]StageFn{Panic},
+		[]StageFn{Exec("sleep 0.1 && echo -n fine")},
+	))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("fine"), got)
+
+	_, err = Run(nil, Race(
+		[]StageFn{Panic},
+	))
+	assert.True(t, strings.HasPrefix(err.Error(), "branch 0: sub-pipeline panicked: "), err.Error())
+
+	_, err = Run(nil, Race(
+		[]StageFn{Exec("exit 1")},
+		[]StageFn{Exec("exit 2")},
+	))
+	assert.Equal(t, "branch 0: exit status 1\nbranch 1: exit status 2", err.Error())
+
+	_, err = Run(nil, Race())
+	assert.Equal(t, "at least one branch is required", err.Error())
+}
+
+func TestForEachAppend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	assert.Nil(t, err)
+	out := path.Join(dir, "out")
+
+	got, err := Run(nil,
+		Insert([]string{"a", "b", "c"}),
+		ForEachAppend(out, Exec(`echo "#{content}"`)),
+		Exec("cat #{file}"),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("a\nb\nc\n"), got)
+
+	_, err = Run(nil,
+		Insert([]string{"d", "e"}),
+		ForEachAppend(out, Exec(`[ "#{content}" = d ] && echo "#{content}"`)),
+	)
+	assert.Equal(t, "item 1: exit status 1", err.Error())
+	content, err := ioutil.ReadFile(out)
+	assert.Nil(t, err)
+	assert.Equal(t, "a\nb\nc\nd\n", string(content))
+}
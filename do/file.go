@@ -0,0 +1,491 @@
+package do
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// WriteFileAtomic writes the content of the previous stage to a temporary
+// file in the same directory as toFile, and renames it over toFile once
+// it has been written completely, so that readers never see a partially
+// written file. The temporary file is removed if writing fails.
+func WriteFileAtomic(toFile string, perm os.FileMode) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		content, err := contentOf(input)
+		if err != nil {
+			return nil, err
+		}
+		ReportProgress(progress, "Atomically writing content to file: %s", toFile)
+
+		if err := writeAtomic(toFile, content, perm); err != nil {
+			return nil, err
+		}
+		return os.Open(toFile)
+	}
+}
+
+// writeAtomic writes the content to a temporary file in the same directory
+// as toFile, and renames it over toFile, see WriteFileAtomic
+func writeAtomic(toFile string, content []byte, perm os.FileMode) (err error) {
+	tmp, err := ioutil.TempFile(filepath.Dir(toFile), "."+filepath.Base(toFile)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err = tmp.Write(content); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Chmod(perm); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), toFile)
+}
+
+// SaveSplit writes the Left and the Right of the SplitResult input, which
+// must be string or []byte, to leftFile and rightFile respectively, in the
+// same way as WriteFileAtomic, and passes the SplitResult on unchanged.
+func SaveSplit(leftFile, rightFile string) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		result, ok := input.(SplitResult)
+		if !ok {
+			return nil, fmt.Errorf("provided input must be SplitResult")
+		}
+		for _, side := range []struct {
+			name   string
+			toFile string
+			value  interface{}
+		}{
+			{name: "left", toFile: leftFile, value: result.Left},
+			{name: "right", toFile: rightFile, value: result.Right},
+		} {
+			content, err := contentOf(side.value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", side.name, err)
+			}
+			ReportProgress(progress, "Atomically writing %s content to file: %s", side.name, side.toFile)
+			if err := writeAtomic(side.toFile, content, 0666); err != nil {
+				return nil, fmt.Errorf("%s: %w", side.name, err)
+			}
+		}
+		return result, nil
+	}
+}
+
+// ListOptions configures ListDir
+type ListOptions struct {
+	// Recursive lists the entries of subdirectories as well
+	Recursive bool
+	// FullPaths returns the entries prefixed with the listed directory,
+	// instead of relative to it
+	FullPaths bool
+	// Pattern only returns entries whose base name matches the
+	// filepath.Match pattern, all entries are returned when empty
+	Pattern string
+}
+
+// ListDir returns the entries of the directory as a sorted []string, which
+// includes both files and subdirectories. This discards the content of the
+// previous stage.
+func ListDir(dir string, opts ListOptions) StageFn {
+	return func(_ interface{}, progress io.Writer) (interface{}, error) {
+		if opts.Pattern != "" {
+			if _, err := filepath.Match(opts.Pattern, ""); err != nil {
+				return nil, err
+			}
+		}
+		ReportProgress(progress, "Listing directory: %s", dir)
+
+		entries := []string{}
+		err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if p == dir {
+				return nil
+			}
+			if opts.Pattern != "" {
+				// The pattern has been validated above
+				if ok, _ := filepath.Match(opts.Pattern, info.Name()); ok {
+					entries = append(entries, p)
+				}
+			} else {
+				entries = append(entries, p)
+			}
+			if info.IsDir() && !opts.Recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if !opts.FullPaths {
+			for i, entry := range entries {
+				if entries[i], err = filepath.Rel(dir, entry); err != nil {
+					return nil, err
+				}
+			}
+		}
+		sort.Strings(entries)
+		return entries, nil
+	}
+}
+
+// GlobOption configures Glob
+type GlobOption func(g *globbing)
+
+type globbing struct {
+	errorIfEmpty bool
+}
+
+// ErrorIfEmpty fails Glob when no paths match the pattern
+func ErrorIfEmpty(g *globbing) {
+	g.errorIfEmpty = true
+}
+
+// Glob returns the paths matching the filepath.Glob pattern as []string,
+// which is empty when nothing matches, unless ErrorIfEmpty is provided. This
+// discards the content of the previous stage.
+func Glob(pattern string, opts ...GlobOption) StageFn {
+	g := &globbing{}
+	for _, opt := range opts {
+		opt(g)
+	}
+	return func(_ interface{}, progress io.Writer) (interface{}, error) {
+		ReportProgress(progress, "Matching paths: %s", pattern)
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			if g.errorIfEmpty {
+				return nil, fmt.Errorf("no paths match pattern: %s", pattern)
+			}
+			return []string{}, nil
+		}
+		return matches, nil
+	}
+}
+
+// Truncate truncates the file to zero length, creating it if it doesn't
+// exist, and passes the input of the previous stage on unchanged. The path
+// can contain placeholders, which are replaced in the same way as Exec does
+// for its command.
+func Truncate(path string) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		data, ok := input.(interceptExec)
+		if !ok {
+			// Should never reach this point
+			return nil, fmt.Errorf("truncate stage wasn't intercepted")
+		}
+		path, err := InterpolateString(path, data.Input, data.Vars)
+		if err != nil {
+			return nil, err
+		}
+		ReportProgress(progress, "Truncating file: %s", path)
+
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+		if err != nil {
+			return nil, err
+		}
+		if err := f.Close(); err != nil {
+			return nil, err
+		}
+		return data.Input, nil
+	}
+}
+
+// RemoveOption configures Remove and RemoveAll
+type RemoveOption func(r *removal)
+
+type removal struct {
+	errorIfMissing bool
+}
+
+// ErrorIfMissing fails Remove and RemoveAll when the path doesn't exist
+func ErrorIfMissing(r *removal) {
+	r.errorIfMissing = true
+}
+
+// Remove removes the file or empty directory, and passes the input of the
+// previous stage on unchanged. A path that doesn't exist is ignored, unless
+// ErrorIfMissing is provided. The path can contain placeholders, which are
+// replaced in the same way as Exec does for its command.
+func Remove(path string, opts ...RemoveOption) StageFn {
+	return remove(path, os.Remove, opts)
+}
+
+// RemoveAll removes the path and anything it contains in the same way as
+// Remove
+func RemoveAll(path string, opts ...RemoveOption) StageFn {
+	return remove(path, os.RemoveAll, opts)
+}
+
+func remove(path string, removeFn func(string) error, opts []RemoveOption) StageFn {
+	r := &removal{}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		data, ok := input.(interceptExec)
+		if !ok {
+			// Should never reach this point
+			return nil, fmt.Errorf("remove stage wasn't intercepted")
+		}
+		path, err := InterpolateString(path, data.Input, data.Vars)
+		if err != nil {
+			return nil, err
+		}
+		ReportProgress(progress, "Removing: %s", path)
+
+		if r.errorIfMissing {
+			if _, err := os.Lstat(path); err != nil {
+				return nil, err
+			}
+		}
+		if err := removeFn(path); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		return data.Input, nil
+	}
+}
+
+// Move renames the *os.File or path string input to dst, copying it and
+// removing the original when dst is on a different device. An *os.File
+// input results in an *os.File of dst, a path in the path dst. The
+// destination can contain placeholders, which are replaced in the same way
+// as Exec does for its command.
+func Move(dst string) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		data, ok := input.(interceptExec)
+		if !ok {
+			// Should never reach this point
+			return nil, fmt.Errorf("move stage wasn't intercepted")
+		}
+		src, err := pathOf(data.Input)
+		if err != nil {
+			return nil, err
+		}
+		dst, err := InterpolateString(dst, data.Input, data.Vars)
+		if err != nil {
+			return nil, err
+		}
+		ReportProgress(progress, "Moving %s to: %s", src, dst)
+
+		if err := os.Rename(src, dst); err != nil {
+			if !isCrossDevice(err) {
+				return nil, err
+			}
+			if err := copyFile(src, dst); err != nil {
+				return nil, err
+			}
+			if err := os.Remove(src); err != nil {
+				return nil, err
+			}
+		}
+
+		if _, ok := data.Input.(*os.File); ok {
+			return os.Open(dst)
+		}
+		return dst, nil
+	}
+}
+
+// pathOf returns the path string input, or the name of the *os.File input
+func pathOf(input interface{}) (string, error) {
+	switch data := input.(type) {
+	case *os.File:
+		return data.Name(), nil
+	case string:
+		return data, nil
+	default:
+		return "", fmt.Errorf("provided input must be *os.File or string")
+	}
+}
+
+// copyFile copies the content and mode of the regular file src to dst
+func copyFile(src, dst string) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	// Copy to a temporary file that is renamed into place, in the same way
+	// as writeAtomic, so that a failing copy doesn't leave a partial dst
+	tmp, err := ioutil.TempFile(filepath.Dir(dst), "."+filepath.Base(dst)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+	if _, err = io.Copy(tmp, in); err != nil {
+		return err
+	}
+	if err = tmp.Chmod(info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+// AbsPath returns the absolute path of the path string or *os.File input as
+// string
+func AbsPath() StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		p, err := pathOf(input)
+		if err != nil {
+			return nil, err
+		}
+		return filepath.Abs(p)
+	}
+}
+
+// RelPath returns the path string or *os.File input relative to base as
+// string
+func RelPath(base string) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		p, err := pathOf(input)
+		if err != nil {
+			return nil, err
+		}
+		return filepath.Rel(base, p)
+	}
+}
+
+// Stat returns the os.FileInfo of the path string or *os.File input, to base
+// decisions of later stages on its size, modification time or mode. Note
+// that the info is passed on instead of the content of the file.
+func Stat() StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		p, err := pathOf(input)
+		if err != nil {
+			return nil, err
+		}
+		return os.Stat(p)
+	}
+}
+
+// FilesEqual compares the content of the *os.File or path string input with
+// the file other byte-for-byte, e.g., against a golden file, and passes the
+// input on unchanged if they are equal. The error reports the offset of the
+// first byte that differs, which is the size of the shorter file if one is a
+// prefix of the other.
+func FilesEqual(other string) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		p, err := pathOf(input)
+		if err != nil {
+			return nil, err
+		}
+		ReportProgress(progress, "Comparing %s with: %s", p, other)
+
+		offset, equal, err := compareFiles(p, other)
+		if err != nil {
+			return nil, err
+		}
+		if !equal {
+			return nil, fmt.Errorf("files differ at offset %d: %s, %s", offset, p, other)
+		}
+		return input, nil
+	}
+}
+
+// compareFiles reads both files in chunks and returns the offset of the
+// first byte that differs
+func compareFiles(a, b string) (int64, bool, error) {
+	fa, err := os.Open(a)
+	if err != nil {
+		return 0, false, err
+	}
+	defer func() {
+		_ = fa.Close()
+	}()
+	fb, err := os.Open(b)
+	if err != nil {
+		return 0, false, err
+	}
+	defer func() {
+		_ = fb.Close()
+	}()
+
+	bufA, bufB := make([]byte, 32*1024), make([]byte, 32*1024)
+	var offset int64
+	for {
+		na, errA := io.ReadFull(fa, bufA)
+		if errA != nil && errA != io.EOF && errA != io.ErrUnexpectedEOF {
+			return 0, false, errA
+		}
+		nb, errB := io.ReadFull(fb, bufB)
+		if errB != nil && errB != io.EOF && errB != io.ErrUnexpectedEOF {
+			return 0, false, errB
+		}
+		for i := 0; i < na && i < nb; i++ {
+			if bufA[i] != bufB[i] {
+				return offset + int64(i), false, nil
+			}
+		}
+		if na != nb {
+			if na < nb {
+				return offset + int64(na), false, nil
+			}
+			return offset + int64(nb), false, nil
+		}
+		if errA != nil {
+			return 0, true, nil
+		}
+		offset += int64(na)
+	}
+}
+
+// SkipIfExists runs the provided stages as a sub-pipeline, with the input of
+// the previous stage and a copy of the variables, only if path doesn't exist
+// yet, and passes the input on unchanged otherwise. This avoids redoing work
+// that already produced its artifact. The path can contain placeholders,
+// which are replaced in the same way as Exec does for its command.
+func SkipIfExists(path string, stages ...StageFn) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		data, ok := input.(interceptExec)
+		if !ok {
+			// Should never reach this point
+			return nil, fmt.Errorf("skip if exists stage wasn't intercepted")
+		}
+		path, err := InterpolateString(path, data.Input, data.Vars)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(path); err == nil {
+			ReportProgress(progress, "Skipping stages, path exists: %s", path)
+			return data.Input, nil
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+		return run(contextOf(data), progress, data.Input, copyVars(data.Vars), stages)
+	}
+}
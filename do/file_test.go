@@ -0,0 +1,390 @@
+package do
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	assert.Nil(t, err)
+
+	listDir, err := ioutil.TempDir("", "")
+	defer func() {
+		_ = os.RemoveAll(listDir)
+	}()
+	assert.Nil(t, err)
+	assert.Nil(t, os.MkdirAll(path.Join(listDir, "sub"), 0755))
+	for _, name := range []string{"a.txt", "b.log", path.Join("sub", "c.txt")} {
+		assert.Nil(t, ioutil.WriteFile(path.Join(listDir, name), nil, 0644))
+	}
+
+	for name, content := range map[string]string{"golden": "hello there", "same": "hello there", "other": "hello world", "short": "hello"} {
+		assert.Nil(t, ioutil.WriteFile(path.Join(dir, name), []byte(content), 0644))
+	}
+
+	wd, err := os.Getwd()
+	assert.Nil(t, err)
+
+	testCases := []struct {
+		name        string
+		stages      []StageFn
+		expect      interface{}
+		expectError bool
+	}{
+		{
+			name: "write file atomic",
+			stages: []StageFn{
+				Insert("old content"),
+				WriteFileAtomic(path.Join(dir, "atomic"), 0600),
+				Insert("new content"),
+				WriteFileAtomic(path.Join(dir, "atomic"), 0600),
+				Exec("cat #{file}"),
+			},
+			expect:      []byte("new content"),
+			expectError: false,
+		},
+		{
+			name: "list dir",
+			stages: []StageFn{
+				ListDir(listDir, ListOptions{}),
+			},
+			expect:      []string{"a.txt", "b.log", "sub"},
+			expectError: false,
+		},
+		{
+			name: "list dir recursive",
+			stages: []StageFn{
+				ListDir(listDir, ListOptions{Recursive: true, Pattern: "*.txt"}),
+			},
+			expect:      []string{"a.txt", path.Join("sub", "c.txt")},
+			expectError: false,
+		},
+		{
+			name: "list dir full paths",
+			stages: []StageFn{
+				ListDir(listDir, ListOptions{FullPaths: true, Pattern: "*.log"}),
+			},
+			expect:      []string{path.Join(listDir, "b.log")},
+			expectError: false,
+		},
+		{
+			name: "list dir invalid pattern",
+			stages: []StageFn{
+				ListDir(listDir, ListOptions{Pattern: "["}),
+			},
+			expect:      filepath.ErrBadPattern,
+			expectError: true,
+		},
+		{
+			name: "glob",
+			stages: []StageFn{
+				Glob(path.Join(listDir, "*", "*.txt")),
+			},
+			expect:      []string{path.Join(listDir, "sub", "c.txt")},
+			expectError: false,
+		},
+		{
+			name: "glob no matches",
+			stages: []StageFn{
+				Glob(path.Join(listDir, "*.csv")),
+			},
+			expect:      []string{},
+			expectError: false,
+		},
+		{
+			name: "glob no matches error",
+			stages: []StageFn{
+				Glob(path.Join(listDir, "*.csv"), ErrorIfEmpty),
+			},
+			expect:      fmt.Errorf("no paths match pattern: %s", path.Join(listDir, "*.csv")),
+			expectError: true,
+		},
+		{
+			name: "truncate",
+			stages: []StageFn{
+				Insert("some content"),
+				WriteFile(path.Join(dir, "truncated")),
+				Insert("truncated"),
+				SaveInVar("name"),
+				Insert("hello"),
+				Truncate(path.Join(dir, "#{name}")),
+				Exec("echo -n #{content} && cat " + path.Join(dir, "truncated")),
+			},
+			expect:      []byte("hello"),
+			expectError: false,
+		},
+		{
+			name: "truncate missing directory",
+			stages: []StageFn{
+				Truncate(path.Join(dir, "missing", "truncated")),
+			},
+			expect:      fmt.Errorf("open %s: no such file or directory", path.Join(dir, "missing", "truncated")),
+			expectError: true,
+		},
+		{
+			name: "remove",
+			stages: []StageFn{
+				Insert("some content"),
+				WriteFile(path.Join(dir, "removed")),
+				Insert("hello"),
+				Remove(path.Join(dir, "removed")),
+				Remove(path.Join(dir, "removed")),
+				Exec("echo -n #{content} && ls " + path.Join(dir, "removed") + " 2> /dev/null"),
+			},
+			expect:      fmt.Errorf("exit status 2"),
+			expectError: true,
+		},
+		{
+			name: "remove missing strict",
+			stages: []StageFn{
+				Remove(path.Join(dir, "missing"), ErrorIfMissing),
+			},
+			expect:      fmt.Errorf("lstat %s: no such file or directory", path.Join(dir, "missing")),
+			expectError: true,
+		},
+		{
+			name: "remove all",
+			stages: []StageFn{
+				Insert("tree"),
+				SaveInVar("name"),
+				Exec("mkdir -p " + path.Join(dir, "tree", "sub") + " && touch " + path.Join(dir, "tree", "sub", "file")),
+				RemoveAll(path.Join(dir, "#{name}"), ErrorIfMissing),
+				RemoveAll(path.Join(dir, "#{name}")),
+				Glob(path.Join(dir, "tree")),
+			},
+			expect:      []string{},
+			expectError: false,
+		},
+		{
+			name: "remove non-empty directory",
+			stages: []StageFn{
+				Exec("mkdir -p " + path.Join(dir, "full") + " && touch " + path.Join(dir, "full", "file")),
+				Remove(path.Join(dir, "full")),
+			},
+			expect:      fmt.Errorf("remove %s: directory not empty", path.Join(dir, "full")),
+			expectError: true,
+		},
+		{
+			name: "move temp file",
+			stages: []StageFn{
+				Insert("moved"),
+				SaveInVar("name"),
+				Insert("some content"),
+				WriteTempFile,
+				Move(path.Join(dir, "#{name}")),
+				Exec("cat #{file}"),
+			},
+			expect:      []byte("some content"),
+			expectError: false,
+		},
+		{
+			name: "move path",
+			stages: []StageFn{
+				Insert(path.Join(dir, "moved")),
+				Move(path.Join(dir, "moved again")),
+			},
+			expect:      path.Join(dir, "moved again"),
+			expectError: false,
+		},
+		{
+			name: "move missing",
+			stages: []StageFn{
+				Insert(path.Join(dir, "missing")),
+				Move(path.Join(dir, "moved")),
+			},
+			expect:      fmt.Errorf("rename %s %s: no such file or directory", path.Join(dir, "missing"), path.Join(dir, "moved")),
+			expectError: true,
+		},
+		{
+			name: "abs path",
+			stages: []StageFn{
+				Insert("some content"),
+				WriteFile(path.Join(dir, "abs")),
+				RelPath(wd),
+				AbsPath(),
+			},
+			expect:      path.Join(dir, "abs"),
+			expectError: false,
+		},
+		{
+			name: "rel path",
+			stages: []StageFn{
+				Insert(path.Join(dir, "sub", "file")),
+				RelPath(dir),
+			},
+			expect:      path.Join("sub", "file"),
+			expectError: false,
+		},
+		{
+			name: "rel path error",
+			stages: []StageFn{
+				Insert("file"),
+				RelPath(dir),
+			},
+			expect:      fmt.Errorf("Rel: can't make file relative to %s", dir),
+			expectError: true,
+		},
+		{
+			name: "abs path invalid input",
+			stages: []StageFn{
+				Insert(42),
+				AbsPath(),
+			},
+			expect:      fmt.Errorf("provided input must be *os.File or string"),
+			expectError: true,
+		},
+		{
+			name: "stat missing",
+			stages: []StageFn{
+				Insert(path.Join(dir, "missing")),
+				Stat(),
+			},
+			expect:      fmt.Errorf("stat %s: no such file or directory", path.Join(dir, "missing")),
+			expectError: true,
+		},
+		{
+			name: "files equal",
+			stages: []StageFn{
+				Insert(path.Join(dir, "same")),
+				FilesEqual(path.Join(dir, "golden")),
+			},
+			expect:      path.Join(dir, "same"),
+			expectError: false,
+		},
+		{
+			name: "files differ",
+			stages: []StageFn{
+				Insert(path.Join(dir, "other")),
+				FilesEqual(path.Join(dir, "golden")),
+			},
+			expect:      fmt.Errorf("files differ at offset 6: %s, %s", path.Join(dir, "other"), path.Join(dir, "golden")),
+			expectError: true,
+		},
+		{
+			name: "files differ in size",
+			stages: []StageFn{
+				LoadFileHandler(path.Join(dir, "short"), os.O_RDONLY, 0),
+				FilesEqual(path.Join(dir, "golden")),
+			},
+			expect:      fmt.Errorf("files differ at offset 5: %s, %s", path.Join(dir, "short"), path.Join(dir, "golden")),
+			expectError: true,
+		},
+		{
+			name: "files equal missing file",
+			stages: []StageFn{
+				Insert(path.Join(dir, "golden")),
+				FilesEqual(path.Join(dir, "missing")),
+			},
+			expect:      fmt.Errorf("open %s: no such file or directory", path.Join(dir, "missing")),
+			expectError: true,
+		},
+		{
+			name: "save split",
+			stages: []StageFn{
+				Insert("hello"),
+				Split(
+					[]StageFn{Exec(`echo -n "#{content} left"`)},
+					[]StageFn{Exec(`echo -n "#{content} right"`)},
+				),
+				SaveSplit(path.Join(dir, "left"), path.Join(dir, "right")),
+				Insert(nil),
+				Exec("cat " + path.Join(dir, "left") + " " + path.Join(dir, "right")),
+			},
+			expect:      []byte("hello lefthello right"),
+			expectError: false,
+		},
+		{
+			name: "save split right failure",
+			stages: []StageFn{
+				Insert("hello"),
+				Split([]StageFn{}, []StageFn{Insert(42)}),
+				SaveSplit(path.Join(dir, "left"), path.Join(dir, "right")),
+			},
+			expect:      fmt.Errorf("right: provided input must be string or []byte"),
+			expectError: true,
+		},
+		{
+			name: "save split invalid input",
+			stages: []StageFn{
+				Insert("hello"),
+				SaveSplit(path.Join(dir, "left"), path.Join(dir, "right")),
+			},
+			expect:      fmt.Errorf("provided input must be SplitResult"),
+			expectError: true,
+		},
+		{
+			name: "skip if exists",
+			stages: []StageFn{
+				Insert("artifact"),
+				SaveInVar("name"),
+				Insert("hello"),
+				SkipIfExists(path.Join(dir, "#{name}"), Exec("echo -n built > "+path.Join(dir, "#{name}"))),
+				SkipIfExists(path.Join(dir, "#{name}"), Exec("echo -n rebuilt > "+path.Join(dir, "#{name}"))),
+				Exec("echo -n #{content} && cat " + path.Join(dir, "artifact")),
+			},
+			expect:      []byte("built"),
+			expectError: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		got, err := Run(nil, tc.stages...)
+		if tc.expectError {
+			assert.Equal(t, tc.expect.(error).Error(), err.Error(), tc.name)
+		} else {
+			assert.Equal(t, tc.expect, got, tc.name)
+			assert.Nil(t, err, tc.name)
+		}
+	}
+
+	_, err = Run(nil, Insert("content"), WriteFileAtomic(path.Join(dir, "missing", "atomic"), 0600))
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+
+	info, err := os.Stat(path.Join(dir, "atomic"))
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	entries, err := ioutil.ReadDir(dir)
+	assert.Nil(t, err)
+	for _, entry := range entries {
+		assert.False(t, strings.HasPrefix(entry.Name(), ".atomic.tmp"), "temporary files should not be left behind")
+	}
+
+	// Files can't be renamed across devices, which is handled by copying
+	assert.Nil(t, ioutil.WriteFile(path.Join(dir, "copied"), []byte("copied"), 0640))
+	assert.Nil(t, copyFile(path.Join(dir, "copied"), path.Join(dir, "copy")))
+	content, err := ioutil.ReadFile(path.Join(dir, "copy"))
+	assert.Nil(t, err)
+	assert.Equal(t, "copied", string(content))
+	info, err = os.Stat(path.Join(dir, "copy"))
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+
+	// A failing copy doesn't leave a partial destination behind, reading a
+	// directory fails once the copy has started
+	assert.Nil(t, os.Mkdir(path.Join(dir, "unreadable"), 0755))
+	assert.NotNil(t, copyFile(path.Join(dir, "unreadable"), path.Join(dir, "partial")))
+	entries, err = ioutil.ReadDir(dir)
+	assert.Nil(t, err)
+	for _, entry := range entries {
+		assert.False(t, strings.Contains(entry.Name(), "partial"), "partial copies should not be left behind: %s", entry.Name())
+	}
+
+	got, err := Run(nil, Insert("some content"), WriteTempFile, Stat())
+	assert.Nil(t, err)
+	info = got.(os.FileInfo)
+	assert.Equal(t, int64(12), info.Size())
+	assert.False(t, info.IsDir())
+}
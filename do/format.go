@@ -0,0 +1,92 @@
+package do
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ParseProperties parses the content of the previous stage as lines of
+// key<separator>value pairs into a map[string]string. If the separator is
+// empty, the first occurrence of either `=` or `:` is used. Blank lines and
+// lines starting with `#` or `!` are ignored, and when a key is defined
+// multiple times the last definition wins.
+func ParseProperties(separator string) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		content, err := contentOf(input)
+		if err != nil {
+			return nil, err
+		}
+		ReportProgress(progress, "Parsing provided content as properties")
+
+		props := map[string]string{}
+		for i, line := range strings.Split(string(content), "\n") {
+			line = strings.TrimSpace(line)
+			if len(line) == 0 || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "!") {
+				continue
+			}
+			var idx int
+			sepLen := len(separator)
+			if sepLen > 0 {
+				idx = strings.Index(line, separator)
+			} else {
+				idx = strings.IndexAny(line, "=:")
+				sepLen = 1
+			}
+			if idx < 0 {
+				return nil, fmt.Errorf("line %d: missing separator in: %s", i+1, line)
+			}
+			key := strings.TrimSpace(line[:idx])
+			if len(key) == 0 {
+				return nil, fmt.Errorf("line %d: missing key in: %s", i+1, line)
+			}
+			props[key] = strings.TrimSpace(line[idx+sepLen:])
+		}
+		return props, nil
+	}
+}
+
+// ParseINI parses the content of the previous stage as INI configuration into
+// a map[string]map[string]string keyed by section and then key. Keys defined
+// before the first section are stored under the empty section "". Blank lines
+// and lines starting with `;` or `#` are ignored.
+func ParseINI() StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		content, err := contentOf(input)
+		if err != nil {
+			return nil, err
+		}
+		ReportProgress(progress, "Parsing provided content as INI")
+
+		section := ""
+		sections := map[string]map[string]string{
+			section: {},
+		}
+		for i, line := range strings.Split(string(content), "\n") {
+			line = strings.TrimSpace(line)
+			if len(line) == 0 || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#") {
+				continue
+			}
+			if strings.HasPrefix(line, "[") {
+				if !strings.HasSuffix(line, "]") {
+					return nil, fmt.Errorf("line %d: unterminated section in: %s", i+1, line)
+				}
+				section = strings.TrimSpace(line[1 : len(line)-1])
+				if _, ok := sections[section]; !ok {
+					sections[section] = map[string]string{}
+				}
+				continue
+			}
+			idx := strings.Index(line, "=")
+			if idx < 0 {
+				return nil, fmt.Errorf("line %d: missing separator in: %s", i+1, line)
+			}
+			key := strings.TrimSpace(line[:idx])
+			if len(key) == 0 {
+				return nil, fmt.Errorf("line %d: missing key in: %s", i+1, line)
+			}
+			sections[section][key] = strings.TrimSpace(line[idx+1:])
+		}
+		return sections, nil
+	}
+}
@@ -0,0 +1,80 @@
+package do
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormat(t *testing.T) {
+	testCases := []struct {
+		name        string
+		stages      []StageFn
+		expect      interface{}
+		expectError bool
+	}{
+		{
+			name: "properties",
+			stages: []StageFn{
+				Insert("# comment\n! other comment\n\nname = bob\nurl: http://localhost:80\nname=alice\n"),
+				ParseProperties(""),
+			},
+			expect: map[string]string{
+				"name": "alice",
+				"url":  "http://localhost:80",
+			},
+			expectError: false,
+		},
+		{
+			name: "properties custom separator",
+			stages: []StageFn{
+				Insert("a -> b=c\n"),
+				ParseProperties("->"),
+			},
+			expect:      map[string]string{"a": "b=c"},
+			expectError: false,
+		},
+		{
+			name: "properties missing separator",
+			stages: []StageFn{
+				Insert("a=b\nbroken\n"),
+				ParseProperties(""),
+			},
+			expect:      fmt.Errorf("line 2: missing separator in: broken"),
+			expectError: true,
+		},
+		{
+			name: "ini",
+			stages: []StageFn{
+				Insert("global = yes\n; comment\n[server]\n  host = localhost \n# comment\nport=80\n\n[ client ]\nname=bob\n"),
+				ParseINI(),
+			},
+			expect: map[string]map[string]string{
+				"":       {"global": "yes"},
+				"server": {"host": "localhost", "port": "80"},
+				"client": {"name": "bob"},
+			},
+			expectError: false,
+		},
+		{
+			name: "ini unterminated section",
+			stages: []StageFn{
+				Insert("[server\nhost=localhost\n"),
+				ParseINI(),
+			},
+			expect:      fmt.Errorf("line 1: unterminated section in: [server"),
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		got, err := Run(nil, tc.stages...)
+		if tc.expectError {
+			assert.Equal(t, tc.expect.(error).Error(), err.Error(), tc.name)
+		} else {
+			assert.Equal(t, tc.expect, got, tc.name)
+			assert.Nil(t, err, tc.name)
+		}
+	}
+}
@@ -0,0 +1,391 @@
+package do
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch"
+)
+
+// ParseNDJSON unmarshals each line of newline delimited JSON content into a
+// fresh value created by the provided factory, e.g., func() interface{} {
+// return &MyStruct{} }, and returns the values as []interface{}. Blank lines
+// are skipped.
+func ParseNDJSON(to func() interface{}) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		content, err := contentOf(input)
+		if err != nil {
+			return nil, err
+		}
+		ReportProgress(progress, "Parsing provided content as NDJSON")
+
+		var out []interface{}
+		for i, line := range strings.Split(string(content), "\n") {
+			line = strings.TrimSpace(line)
+			if len(line) == 0 {
+				continue
+			}
+			v := to()
+			if err := json.Unmarshal([]byte(line), v); err != nil {
+				return nil, fmt.Errorf("line %d: %s", i+1, err)
+			}
+			out = append(out, v)
+		}
+		return out, nil
+	}
+}
+
+// EncodeNDJSON marshals each element of the []interface{} input as JSON on
+// its own line. Every line, including the last, is terminated by a newline,
+// an empty input therefore results in empty content.
+func EncodeNDJSON() StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		items, ok := input.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("provided input must be []interface{}")
+		}
+		ReportProgress(progress, "Encoding %d items as NDJSON", len(items))
+
+		var buf bytes.Buffer
+		for i, item := range items {
+			line, err := json.Marshal(item)
+			if err != nil {
+				return nil, fmt.Errorf("item %d: %s", i, err)
+			}
+			buf.Write(line)
+			buf.WriteByte('\n')
+		}
+		return buf.Bytes(), nil
+	}
+}
+
+// MergeOption alters how MergeJSON combines documents
+type MergeOption func(m *merging)
+
+type merging struct {
+	concatArrays bool
+}
+
+// ConcatArrays appends arrays of the input to the arrays of the base
+// document, instead of replacing them
+func ConcatArrays(m *merging) {
+	m.concatArrays = true
+}
+
+func decodeJSON(content []byte) (interface{}, error) {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(content))
+	dec.UseNumber()
+	if err := decodeDocument(dec, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// decodeDocument decodes the single JSON document of the decoder into to,
+// failing on any content after it
+func decodeDocument(dec *json.Decoder, to interface{}) error {
+	if err := dec.Decode(to); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return fmt.Errorf("unexpected content after JSON document")
+	}
+	return nil
+}
+
+func mergeJSON(base, overlay interface{}, concat bool) interface{} {
+	switch o := overlay.(type) {
+	case map[string]interface{}:
+		b, ok := base.(map[string]interface{})
+		if !ok {
+			return o
+		}
+		for k, v := range o {
+			if existing, found := b[k]; found {
+				b[k] = mergeJSON(existing, v, concat)
+			} else {
+				b[k] = v
+			}
+		}
+		return b
+	case []interface{}:
+		if b, ok := base.([]interface{}); ok && concat {
+			return append(b, o...)
+		}
+		return o
+	default:
+		return o
+	}
+}
+
+// MergeJSON deep merges the JSON document of the previous stage over the
+// provided base document and returns the result as []byte. Objects are
+// merged recursively, while all other values of the input, including arrays,
+// replace those of the base document, unless ConcatArrays is provided.
+func MergeJSON(base []byte, opts ...MergeOption) StageFn {
+	m := &merging{}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		content, err := contentOf(input)
+		if err != nil {
+			return nil, err
+		}
+		ReportProgress(progress, "Merging provided JSON over base document")
+
+		b, err := decodeJSON(base)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base JSON document: %s", err)
+		}
+		overlay, err := decodeJSON(content)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON document: %s", err)
+		}
+		return encodeJSON(mergeJSON(b, overlay, m.concatArrays))
+	}
+}
+
+// ApplyJSONPatch applies the RFC 6902 JSON patch to the JSON document of the
+// previous stage and returns the patched document as []byte.
+func ApplyJSONPatch(patch []byte) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		content, err := contentOf(input)
+		if err != nil {
+			return nil, err
+		}
+		ReportProgress(progress, "Applying JSON patch to provided document")
+
+		p, err := jsonpatch.DecodePatch(patch)
+		if err != nil {
+			return nil, err
+		}
+		return p.Apply(content)
+	}
+}
+
+// InspectJSON writes the string or []byte content of the previous stage,
+// indented as JSON, to the progress under the provided label, and passes
+// the content on unchanged. Content that isn't valid JSON is written as is.
+func InspectJSON(label string) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		content, err := contentOf(input)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, content, "", "  "); err != nil {
+			ReportProgress(progress, "%s (not valid JSON: %s):\n%s", label, err, content)
+		} else {
+			ReportProgress(progress, "%s:\n%s", label, buf.String())
+		}
+		return input, nil
+	}
+}
+
+// SplitResultToJSON marshals the Left and Right of the SplitResult input
+// into a JSON object, under leftKey and rightKey respectively, in the same
+// way as MarshalJSON, and returns it as []byte.
+func SplitResultToJSON(leftKey, rightKey string) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		result, ok := input.(SplitResult)
+		if !ok {
+			return nil, fmt.Errorf("provided input must be SplitResult")
+		}
+		if leftKey == rightKey {
+			return nil, fmt.Errorf("keys must differ, both are: %s", leftKey)
+		}
+		ReportProgress(progress, "Marshalling split result as JSON")
+		return json.Marshal(map[string]interface{}{
+			leftKey:  result.Left,
+			rightKey: result.Right,
+		})
+	}
+}
+
+// CanonicalJSON re-encodes the JSON document of the previous stage with the
+// keys of its objects sorted at all levels, and without insignificant
+// whitespace, and returns it as []byte, so that the same document always
+// results in the same bytes, e.g., for stable diffs in version control.
+// Numbers are kept as written and HTML characters are not escaped.
+func CanonicalJSON() StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		content, err := contentOf(input)
+		if err != nil {
+			return nil, err
+		}
+		ReportProgress(progress, "Canonicalising provided JSON document")
+		doc, err := decodeJSON(content)
+		if err != nil {
+			return nil, err
+		}
+		// Maps are encoded with sorted keys
+		return encodeJSON(doc)
+	}
+}
+
+// encodeJSON marshals v like json.Marshal, but without escaping HTML
+// characters, so that the JSON stages produce the same output for the same
+// document
+func encodeJSON(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// UniqueOption configures UniqueJSONBy
+type UniqueOption func(u *uniqueness)
+
+type uniqueness struct {
+	groupMissing bool
+}
+
+// GroupMissing treats the elements without a value at the path as one
+// group, of which only the first is kept, instead of failing
+func GroupMissing(u *uniqueness) {
+	u.groupMissing = true
+}
+
+// jsonPathValue returns the value at the dotted path of the decoded JSON
+// value, e.g., "user.id", where array elements are selected by their index,
+// e.g., "tags.0"
+func jsonPathValue(v interface{}, path string) (interface{}, bool) {
+	for _, part := range strings.Split(path, ".") {
+		switch data := v.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if v, ok = data[part]; !ok {
+				return nil, false
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(data) {
+				return nil, false
+			}
+			v = data[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// UniqueJSONBy removes the elements of the JSON array input that have the
+// same value at the dotted path, e.g., "user.id", as an earlier element, and
+// returns the remaining array as []byte, e.g., to consolidate the results of
+// paginated API responses. Values are compared by their JSON encoding, where
+// numbers are compared by their value, so 1, 1.0 and 1e0 are the same. An
+// element without a value at the path fails the stage, unless GroupMissing
+// is provided.
+func UniqueJSONBy(path string, opts ...UniqueOption) StageFn {
+	u := &uniqueness{}
+	for _, opt := range opts {
+		opt(u)
+	}
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		content, err := contentOf(input)
+		if err != nil {
+			return nil, err
+		}
+		doc, err := decodeJSON(content)
+		if err != nil {
+			return nil, err
+		}
+		items, ok := doc.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("provided input must be a JSON array")
+		}
+		ReportProgress(progress, "Removing duplicate elements by: %s", path)
+
+		seen := map[string]bool{}
+		seenMissing := false
+		out := []interface{}{}
+		for i, item := range items {
+			v, ok := jsonPathValue(item, path)
+			if !ok {
+				if !u.groupMissing {
+					return nil, fmt.Errorf("item %d: no value at path: %s", i, path)
+				}
+				if !seenMissing {
+					seenMissing = true
+					out = append(out, item)
+				}
+				continue
+			}
+			key, err := encodeJSON(normaliseNumbers(v))
+			if err != nil {
+				return nil, fmt.Errorf("item %d: %w", i, err)
+			}
+			if !seen[string(key)] {
+				seen[string(key)] = true
+				out = append(out, item)
+			}
+		}
+		ReportProgress(progress, "Removed %d duplicate elements", len(items)-len(out))
+		return encodeJSON(out)
+	}
+}
+
+// normaliseNumbers replaces the numbers in the decoded JSON value with the
+// canonical form of canonicalNumber, so that equal numbers encode the same
+func normaliseNumbers(v interface{}) interface{} {
+	switch t := v.(type) {
+	case json.Number:
+		return canonicalNumber(t)
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, e := range t {
+			out[i] = normaliseNumbers(e)
+		}
+		return out
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			out[k] = normaliseNumbers(e)
+		}
+		return out
+	}
+	return v
+}
+
+// canonicalNumber rewrites the number as its significant digits followed by
+// the exponent, e.g., 1.50 and 15e-1 both become 15e-1, and zero becomes 0.
+// The digits are kept as text, so large integers don't lose precision.
+func canonicalNumber(n json.Number) json.Number {
+	s := string(n)
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign = "-"
+		s = s[1:]
+	}
+	exp := 0
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		e, err := strconv.Atoi(s[i+1:])
+		if err != nil {
+			// The exponent is out of range, compare by the text instead
+			return n
+		}
+		exp = e
+		s = s[:i]
+	}
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		exp -= len(s) - i - 1
+		s = s[:i] + s[i+1:]
+	}
+	digits := strings.TrimLeft(s, "0")
+	if digits == "" {
+		return "0"
+	}
+	trimmed := strings.TrimRight(digits, "0")
+	exp += len(digits) - len(trimmed)
+	return json.Number(fmt.Sprintf("%s%se%d", sign, trimmed, exp))
+}
@@ -0,0 +1,331 @@
+package do
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSON(t *testing.T) {
+	newTest := func() interface{} {
+		return &Test{}
+	}
+
+	testCases := []struct {
+		name        string
+		stages      []StageFn
+		expect      interface{}
+		expectError bool
+	}{
+		{
+			name: "parse ndjson",
+			stages: []StageFn{
+				Insert("{\"name\": \"bob\"}\n\n{\"name\": \"alice\"}\n"),
+				ParseNDJSON(newTest),
+			},
+			expect:      []interface{}{&Test{Name: "bob"}, &Test{Name: "alice"}},
+			expectError: false,
+		},
+		{
+			name: "parse ndjson error",
+			stages: []StageFn{
+				Insert("{\"name\": \"bob\"}\n{\"name\": }\n"),
+				ParseNDJSON(newTest),
+			},
+			expect:      fmt.Errorf("line 2: invalid character '}' looking for beginning of value"),
+			expectError: true,
+		},
+		{
+			name: "encode ndjson",
+			stages: []StageFn{
+				Insert([]interface{}{&Test{Name: "bob"}, map[string]int{"a": 1}}),
+				EncodeNDJSON(),
+			},
+			expect:      []byte("{\"name\":\"bob\"}\n{\"a\":1}\n"),
+			expectError: false,
+		},
+		{
+			name: "ndjson round trip",
+			stages: []StageFn{
+				Insert("{\"name\": \"bob\"}\n{\"name\": \"alice\"}"),
+				ParseNDJSON(newTest),
+				EncodeNDJSON(),
+			},
+			expect:      []byte("{\"name\":\"bob\"}\n{\"name\":\"alice\"}\n"),
+			expectError: false,
+		},
+		{
+			name: "encode ndjson error",
+			stages: []StageFn{
+				Insert([]interface{}{func() {}}),
+				EncodeNDJSON(),
+			},
+			expect:      fmt.Errorf("item 0: json: unsupported type: func()"),
+			expectError: true,
+		},
+		{
+			name: "merge json",
+			stages: []StageFn{
+				Insert(`{"db": {"port": 5433}, "tags": ["b"], "debug": true}`),
+				MergeJSON([]byte(`{"db": {"host": "localhost", "port": 5432}, "tags": ["a"], "big": 12345678901234567890}`)),
+			},
+			expect:      []byte(`{"big":12345678901234567890,"db":{"host":"localhost","port":5433},"debug":true,"tags":["b"]}`),
+			expectError: false,
+		},
+		{
+			name: "merge json concat arrays",
+			stages: []StageFn{
+				Insert(`{"tags": ["b"]}`),
+				MergeJSON([]byte(`{"tags": ["a"]}`), ConcatArrays),
+			},
+			expect:      []byte(`{"tags":["a","b"]}`),
+			expectError: false,
+		},
+		{
+			name: "merge json invalid base",
+			stages: []StageFn{
+				Insert(`{}`),
+				MergeJSON([]byte(`{"a": `)),
+			},
+			expect:      fmt.Errorf("invalid base JSON document: unexpected EOF"),
+			expectError: true,
+		},
+		{
+			name: "merge json HTML characters",
+			stages: []StageFn{
+				Insert(`{"a": "<b>"}`),
+				MergeJSON([]byte(`{"c": "&"}`)),
+			},
+			expect:      []byte(`{"a":"<b>","c":"&"}`),
+			expectError: false,
+		},
+		{
+			name: "merge json invalid input",
+			stages: []StageFn{
+				Insert(`{} {}`),
+				MergeJSON([]byte(`{}`)),
+			},
+			expect:      fmt.Errorf("invalid JSON document: unexpected content after JSON document"),
+			expectError: true,
+		},
+		{
+			name: "apply json patch",
+			stages: []StageFn{
+				Insert(`{"name": "bob", "tags": ["a"]}`),
+				ApplyJSONPatch([]byte(`[
+					{"op": "test", "path": "/name", "value": "bob"},
+					{"op": "replace", "path": "/name", "value": "alice"},
+					{"op": "add", "path": "/tags/-", "value": "b"}
+				]`)),
+				UnmarshalJSON(&map[string]interface{}{}),
+			},
+			expect: &map[string]interface{}{
+				"name": "alice",
+				"tags": []interface{}{"a", "b"},
+			},
+			expectError: false,
+		},
+		{
+			name: "apply json patch failing test",
+			stages: []StageFn{
+				Insert(`{"name": "bob"}`),
+				ApplyJSONPatch([]byte(`[{"op": "test", "path": "/name", "value": "alice"}]`)),
+			},
+			expect:      fmt.Errorf("testing value /name failed: test failed"),
+			expectError: true,
+		},
+		{
+			name: "apply json patch invalid patch",
+			stages: []StageFn{
+				Insert(`{}`),
+				ApplyJSONPatch([]byte(`{"op": "add"}`)),
+			},
+			expect:      fmt.Errorf("json: cannot unmarshal object into Go value of type jsonpatch.Patch"),
+			expectError: true,
+		},
+		{
+			name: "split result to JSON",
+			stages: []StageFn{
+				Insert(`{"name": "bob"}`),
+				Split(
+					[]StageFn{UnmarshalJSON(&Test{})},
+					[]StageFn{UnmarshalJSON(&Test{}), GetName},
+				),
+				SplitResultToJSON("user", "name"),
+			},
+			expect:      []byte(`{"name":"bob","user":{"name":"bob"}}`),
+			expectError: false,
+		},
+		{
+			name: "split result to JSON invalid input",
+			stages: []StageFn{
+				Insert("hello"),
+				SplitResultToJSON("left", "right"),
+			},
+			expect:      fmt.Errorf("provided input must be SplitResult"),
+			expectError: true,
+		},
+		{
+			name: "split result to JSON same keys",
+			stages: []StageFn{
+				Insert("hello"),
+				Split([]StageFn{}, []StageFn{}),
+				SplitResultToJSON("value", "value"),
+			},
+			expect:      fmt.Errorf("keys must differ, both are: value"),
+			expectError: true,
+		},
+		{
+			name: "canonical JSON",
+			stages: []StageFn{
+				Insert(`{"b": [{"z": 1, "a": 1.50}], "a": {"d": "<x>", "c": null}}`),
+				CanonicalJSON(),
+			},
+			expect:      []byte(`{"a":{"c":null,"d":"<x>"},"b":[{"a":1.50,"z":1}]}`),
+			expectError: false,
+		},
+		{
+			name: "canonical JSON invalid input",
+			stages: []StageFn{
+				Insert(`{"a": 1} {"b": 2}`),
+				CanonicalJSON(),
+			},
+			expect:      fmt.Errorf("unexpected content after JSON document"),
+			expectError: true,
+		},
+		{
+			name: "canonical JSON trailing closing brace",
+			stages: []StageFn{
+				Insert(`{"a":1}}`),
+				CanonicalJSON(),
+			},
+			expect:      fmt.Errorf("unexpected content after JSON document"),
+			expectError: true,
+		},
+		{
+			name: "canonical JSON trailing whitespace",
+			stages: []StageFn{
+				Insert("{\"a\":1}\n "),
+				CanonicalJSON(),
+			},
+			expect:      []byte(`{"a":1}`),
+			expectError: false,
+		},
+		{
+			name: "unique JSON by trailing closing bracket",
+			stages: []StageFn{
+				Insert(`[{"id": 1}]]`),
+				UniqueJSONBy("id"),
+			},
+			expect:      fmt.Errorf("unexpected content after JSON document"),
+			expectError: true,
+		},
+		{
+			name: "unique JSON by",
+			stages: []StageFn{
+				Insert(`[{"user": {"id": 1}, "page": 1}, {"user": {"id": 2}, "page": 1}, {"user": {"id": 1}, "page": 2}]`),
+				UniqueJSONBy("user.id"),
+			},
+			expect:      []byte(`[{"page":1,"user":{"id":1}},{"page":1,"user":{"id":2}}]`),
+			expectError: false,
+		},
+		{
+			name: "unique JSON by equal numbers",
+			stages: []StageFn{
+				Insert(`[{"id": 1}, {"id": 1.0}, {"id": 1e0}, {"id": 10E-1}, {"id": -0}, {"id": 0.0}, {"id": "1"}]`),
+				UniqueJSONBy("id"),
+			},
+			expect:      []byte(`[{"id":1},{"id":-0},{"id":"1"}]`),
+			expectError: false,
+		},
+		{
+			name: "unique JSON by large numbers",
+			stages: []StageFn{
+				Insert(`[{"id": 12345678901234567890}, {"id": 12345678901234567891}, {"id": 1234567890123456789e1}]`),
+				UniqueJSONBy("id"),
+			},
+			expect:      []byte(`[{"id":12345678901234567890},{"id":12345678901234567891}]`),
+			expectError: false,
+		},
+		{
+			name: "unique JSON by nested numbers",
+			stages: []StageFn{
+				Insert(`[{"key": {"a": [1, 2.5]}}, {"key": {"a": [1.0, 25e-1]}}, {"key": {"a": [2.5, 1]}}]`),
+				UniqueJSONBy("key"),
+			},
+			expect:      []byte(`[{"key":{"a":[1,2.5]}},{"key":{"a":[2.5,1]}}]`),
+			expectError: false,
+		},
+		{
+			name: "unique JSON by HTML characters",
+			stages: []StageFn{
+				Insert(`[{"id": "<b>"}, {"id": "<b>"}]`),
+				UniqueJSONBy("id"),
+			},
+			expect:      []byte(`[{"id":"<b>"}]`),
+			expectError: false,
+		},
+		{
+			name: "unique JSON by array index",
+			stages: []StageFn{
+				Insert(`[{"tags": ["a", "b"]}, {"tags": ["a", "c"]}, {"tags": ["b"]}]`),
+				UniqueJSONBy("tags.0"),
+			},
+			expect:      []byte(`[{"tags":["a","b"]},{"tags":["b"]}]`),
+			expectError: false,
+		},
+		{
+			name: "unique JSON by missing value",
+			stages: []StageFn{
+				Insert(`[{"id": 1}, {"name": "bob"}]`),
+				UniqueJSONBy("id"),
+			},
+			expect:      fmt.Errorf("item 1: no value at path: id"),
+			expectError: true,
+		},
+		{
+			name: "unique JSON by group missing",
+			stages: []StageFn{
+				Insert(`[{"id": 1}, {"name": "bob"}, {"id": 1}, {"name": "alice"}]`),
+				UniqueJSONBy("id", GroupMissing),
+			},
+			expect:      []byte(`[{"id":1},{"name":"bob"}]`),
+			expectError: false,
+		},
+		{
+			name: "unique JSON by invalid input",
+			stages: []StageFn{
+				Insert(`{"id": 1}`),
+				UniqueJSONBy("id"),
+			},
+			expect:      fmt.Errorf("provided input must be a JSON array"),
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		got, err := Run(nil, tc.stages...)
+		if tc.expectError {
+			assert.Equal(t, tc.expect.(error).Error(), err.Error(), tc.name)
+		} else {
+			assert.Equal(t, tc.expect, got, tc.name)
+			assert.Nil(t, err, tc.name)
+		}
+	}
+}
+
+func TestInspectJSON(t *testing.T) {
+	var progress bytes.Buffer
+	got, err := Run(&progress, Insert(`{"name":"bob","tags":["a"]}`), InspectJSON("user"))
+	assert.Nil(t, err)
+	assert.Equal(t, `{"name":"bob","tags":["a"]}`, got)
+	assert.Equal(t, "\nInserting value into pipeline\n\nuser:\n{\n  \"name\": \"bob\",\n  \"tags\": [\n    \"a\"\n  ]\n}\n", progress.String())
+
+	progress.Reset()
+	got, err = Run(&progress, Insert([]byte("not json")), InspectJSON("raw"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("not json"), got)
+	assert.Equal(t, "\nInserting value into pipeline\n\nraw (not valid JSON: invalid character 'o' in literal null (expecting 'u')):\nnot json\n", progress.String())
+}
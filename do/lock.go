@@ -0,0 +1,61 @@
+package do
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+const lockPollInterval = 50 * time.Millisecond
+
+// WithFileLock acquires an exclusive advisory lock on the lock file, which
+// is created if missing, runs the provided stages as a sub-pipeline with the
+// input of the previous stage and a copy of the variables, and releases the
+// lock afterwards, also when the stages fail. Acquiring the lock blocks,
+// until it is released by its current holder or the context of the pipeline
+// is done. Locking relies on flock(2), and is therefore only supported on
+// unix platforms, elsewhere the stage fails.
+func WithFileLock(path string, stages ...StageFn) StageFn {
+	return func(input interface{}, progress io.Writer) (_ interface{}, err error) {
+		data, ok := input.(interceptExec)
+		if !ok {
+			// Should never reach this point
+			return nil, fmt.Errorf("file lock stage wasn't intercepted")
+		}
+		ctx := contextOf(data)
+
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0666)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			if cerr := f.Close(); cerr != nil && err == nil {
+				err = cerr
+			}
+		}()
+
+		ReportProgress(progress, "Acquiring lock on file: %s", path)
+		for {
+			locked, err := tryLock(f)
+			if err != nil {
+				return nil, err
+			}
+			if locked {
+				break
+			}
+			select {
+			case <-time.After(lockPollInterval):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		defer func() {
+			if uerr := unlock(f); uerr != nil && err == nil {
+				err = uerr
+			}
+		}()
+
+		return run(ctx, progress, data.Input, copyVars(data.Vars), stages)
+	}
+}
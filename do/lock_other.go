@@ -0,0 +1,18 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package do
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+func tryLock(_ *os.File) (bool, error) {
+	return false, fmt.Errorf("file locking is not supported on platform: %s", runtime.GOOS)
+}
+
+func unlock(_ *os.File) error {
+	return nil
+}
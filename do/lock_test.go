@@ -0,0 +1,68 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+// +build linux darwin freebsd netbsd openbsd dragonfly
+
+package do
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	assert.Nil(t, err)
+
+	lockFile := path.Join(dir, "lock")
+	out := path.Join(dir, "out")
+
+	got, err := Run(nil, Insert("hello"), WithFileLock(lockFile, Exec(`echo -n "#{content}"`)))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("hello"), got)
+
+	_, err = Run(nil, WithFileLock(lockFile, Exec("exit 1")))
+	assert.Equal(t, "exit status 1", err.Error())
+
+	// Concurrent pipelines must not interleave their writes
+	done := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := Run(nil, WithFileLock(lockFile,
+				Exec("echo start >> "+out+" && sleep 0.2 && echo end >> "+out),
+			))
+			done <- err
+		}()
+	}
+	assert.Nil(t, <-done)
+	assert.Nil(t, <-done)
+	content, err := ioutil.ReadFile(out)
+	assert.Nil(t, err)
+	assert.Equal(t, "start\nend\nstart\nend\n", string(content))
+
+	// Waiting for the lock is cancelled with the pipeline
+	held := make(chan struct{})
+	release := make(chan struct{})
+	go func() {
+		_, _ = Run(nil, WithFileLock(lockFile, func(_ interface{}, _ io.Writer) (interface{}, error) {
+			close(held)
+			<-release
+			return nil, nil
+		}))
+	}()
+	<-held
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = RunContext(ctx, nil, WithFileLock(lockFile, Insert(nil)))
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	close(release)
+}
@@ -0,0 +1,251 @@
+package do
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const portPollInterval = 100 * time.Millisecond
+
+// WaitForPort polls the TCP endpoint at host and port until it accepts a
+// connection, and passes the input of the previous stage on unchanged. The
+// stage fails when the endpoint isn't available within timeout, or when
+// the context of the pipeline is done.
+func WaitForPort(host string, port int, timeout time.Duration) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		data, ok := input.(interceptExec)
+		if !ok {
+			// Should never reach this point
+			return nil, fmt.Errorf("wait for port stage wasn't intercepted")
+		}
+		ctx, cancel := context.WithTimeout(contextOf(data), timeout)
+		defer cancel()
+
+		address := net.JoinHostPort(host, strconv.Itoa(port))
+		var dialer net.Dialer
+		for attempt := 1; ; attempt++ {
+			ReportProgress(progress, "Waiting for port: %s, attempt %d", address, attempt)
+			conn, err := dialer.DialContext(ctx, "tcp", address)
+			if err == nil {
+				_ = conn.Close()
+				return data.Input, nil
+			}
+			select {
+			case <-time.After(portPollInterval):
+			case <-ctx.Done():
+				if contextOf(data).Err() != nil {
+					return nil, contextOf(data).Err()
+				}
+				return nil, fmt.Errorf("port %s not available within %s: %w", address, timeout, err)
+			}
+		}
+	}
+}
+
+// PostWebhook renders the text/template with the input of the previous
+// stage, where string and []byte input is provided as string, and posts the
+// result as JSON payload to the url, e.g., of a Slack webhook. The template
+// can use the json function to embed a value as JSON, e.g.,
+// {"text": {{ json . }}}. The input is passed on unchanged, unless the
+// webhook responds with a status other than 2xx.
+func PostWebhook(url string, tmpl string) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		data, ok := input.(interceptExec)
+		if !ok {
+			// Should never reach this point
+			return nil, fmt.Errorf("post webhook stage wasn't intercepted")
+		}
+		t, err := template.New("webhook").Funcs(template.FuncMap{
+			"json": func(v interface{}) (string, error) {
+				b, err := json.Marshal(v)
+				return string(b), err
+			},
+		}).Parse(tmpl)
+		if err != nil {
+			return nil, err
+		}
+		value := data.Input
+		if content, err := contentOf(value); err == nil {
+			value = string(content)
+		}
+		var payload bytes.Buffer
+		if err := t.Execute(&payload, value); err != nil {
+			return nil, err
+		}
+
+		ReportProgress(progress, "Posting to webhook: %s", url)
+		req, err := http.NewRequestWithContext(contextOf(data), http.MethodPost, url, &payload)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+			return nil, fmt.Errorf("webhook responded with status: %s, body: %s", resp.Status, strings.TrimSpace(string(body)))
+		}
+		return data.Input, nil
+	}
+}
+
+// HTTPStream requests url and calls lineFn for each line of the response as
+// it arrives, without buffering the response, e.g., to process server-sent
+// events or a log tail in real time. It returns once the response ends, or
+// lineFn fails, or the context of the pipeline is done, and passes the input
+// of the previous stage on unchanged. A trailing carriage return is removed
+// from each line.
+func HTTPStream(url string, lineFn func(line string) error) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		data, ok := input.(interceptExec)
+		if !ok {
+			// Should never reach this point
+			return nil, fmt.Errorf("http stream stage wasn't intercepted")
+		}
+		ctx := contextOf(data)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		ReportProgress(progress, "Streaming response of: %s", url)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+			return nil, fmt.Errorf("request responded with status: %s, body: %s", resp.Status, strings.TrimSpace(string(body)))
+		}
+
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		lines := 0
+		for scanner.Scan() {
+			lines++
+			if err := lineFn(strings.TrimSuffix(scanner.Text(), "\r")); err != nil {
+				return nil, fmt.Errorf("line %d: %w", lines, err)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			if ctx.Err() != nil {
+				return nil, fmt.Errorf("stream interrupted after %d lines: %w", lines, ctx.Err())
+			}
+			return nil, err
+		}
+		ReportProgress(progress, "Stream ended after %d lines", lines)
+		return data.Input, nil
+	}
+}
+
+// PushOption configures PushMetrics
+type PushOption func(p *push)
+
+type push struct {
+	warnOnError bool
+}
+
+// WarnOnPushError reports a failed push to the progress and passes the input
+// on, instead of failing the pipeline, so that monitoring being unavailable
+// doesn't fail the work it monitors
+func WarnOnPushError(p *push) {
+	p.warnOnError = true
+}
+
+var metricName = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// PushMetrics pushes the metrics as gauges, grouped by job, to the Prometheus
+// pushgateway at url, e.g., to record the number of processed items of a
+// scheduled pipeline, and passes the input of the previous stage on
+// unchanged. The metrics replace those previously pushed for the job, which
+// must not be empty.
+func PushMetrics(url, job string, metrics map[string]float64, opts ...PushOption) StageFn {
+	p := &push{}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		data, ok := input.(interceptExec)
+		if !ok {
+			// Should never reach this point
+			return nil, fmt.Errorf("push metrics stage wasn't intercepted")
+		}
+		if job == "" {
+			return nil, fmt.Errorf("job name must not be empty")
+		}
+		names := make([]string, 0, len(metrics))
+		for name := range metrics {
+			if !metricName.MatchString(name) {
+				return nil, fmt.Errorf("invalid metric name: %s, must match: %s", name, metricName)
+			}
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		var payload bytes.Buffer
+		for _, name := range names {
+			fmt.Fprintf(&payload, "# TYPE %s gauge\n%s %s\n", name, name, strconv.FormatFloat(metrics[name], 'g', -1, 64))
+		}
+
+		ReportProgress(progress, "Pushing %d metrics for job: %s", len(metrics), job)
+		if err := pushMetrics(contextOf(data), strings.TrimSuffix(url, "/")+"/metrics/"+jobPath(job), &payload); err != nil {
+			if p.warnOnError {
+				ReportProgress(progress, "Failed to push metrics: %s", err)
+				return data.Input, nil
+			}
+			return nil, err
+		}
+		return data.Input, nil
+	}
+}
+
+// jobPath returns the path segments of the pushgateway grouping key for the
+// job, where a job containing a slash is base64 encoded, as it can't be
+// escaped in a path segment
+func jobPath(job string) string {
+	if strings.Contains(job, "/") {
+		return "job@base64/" + base64.RawURLEncoding.EncodeToString([]byte(job))
+	}
+	return "job/" + neturl.PathEscape(job)
+}
+
+func pushMetrics(ctx context.Context, url string, payload io.Reader) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, payload)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("pushgateway responded with status: %s, body: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
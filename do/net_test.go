@@ -0,0 +1,145 @@
+package do
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWaitForPort(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	port := l.Addr().(*net.TCPAddr).Port
+
+	got, err := Run(nil, Insert("hello"), WaitForPort("127.0.0.1", port, time.Second))
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", got)
+
+	// Nothing listens on the port once the listener is closed
+	assert.Nil(t, l.Close())
+	_, err = Run(nil, WaitForPort("127.0.0.1", port, 300*time.Millisecond))
+	assert.NotNil(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "port 127.0.0.1:"), err.Error())
+	assert.Contains(t, err.Error(), "not available within 300ms")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = RunContext(ctx, nil, WaitForPort("127.0.0.1", port, time.Minute))
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+func TestPostWebhook(t *testing.T) {
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received = append(received, r.Header.Get("Content-Type")+" "+string(body))
+		if strings.Contains(string(body), "fail") {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte("invalid_payload\n"))
+		}
+	}))
+	defer server.Close()
+
+	got, err := Run(nil, Exec(`echo -n 'deployed "v1"'`), PostWebhook(server.URL, `{"text": {{ json . }}}`))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte(`deployed "v1"`), got)
+	assert.Equal(t, []string{`application/json {"text": "deployed \"v1\""}`}, received)
+
+	_, err = Run(nil, Insert("fail"), PostWebhook(server.URL, `{"text": {{ json . }}}`))
+	assert.Equal(t, "webhook responded with status: 400 Bad Request, body: invalid_payload", err.Error())
+
+	_, err = Run(nil, Insert("hello"), PostWebhook(server.URL, `{{ .Missing }}`))
+	assert.Equal(t, `template: webhook:1:3: executing "webhook" at <.Missing>: can't evaluate field Missing in type string`, err.Error())
+}
+
+func TestPushMetrics(t *testing.T) {
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received = append(received, r.Method+" "+r.URL.EscapedPath()+"\n"+string(body))
+		if strings.Contains(r.URL.Path, "broken") {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	metrics := map[string]float64{"processed_items": 42, "duration_seconds": 1.5}
+	got, err := Run(nil, Insert("hello"), PushMetrics(server.URL, "nightly backup", metrics))
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", got)
+	assert.Equal(t, []string{"PUT /metrics/job/nightly%20backup\n# TYPE duration_seconds gauge\nduration_seconds 1.5\n# TYPE processed_items gauge\nprocessed_items 42\n"}, received)
+
+	_, err = Run(nil, PushMetrics(server.URL, "broken", metrics))
+	assert.Equal(t, "pushgateway responded with status: 503 Service Unavailable, body: unavailable", err.Error())
+
+	var progress bytes.Buffer
+	got, err = Run(&progress, Insert("hello"), PushMetrics(server.URL, "broken", metrics, WarnOnPushError))
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", got)
+	assert.Contains(t, progress.String(), "Failed to push metrics: pushgateway responded with status: 503 Service Unavailable")
+
+	received = nil
+	_, err = Run(nil, PushMetrics(server.URL, "backup/nightly", map[string]float64{"items": 1}))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"PUT /metrics/job@base64/YmFja3VwL25pZ2h0bHk\n# TYPE items gauge\nitems 1\n"}, received)
+
+	_, err = Run(nil, PushMetrics(server.URL, "", metrics))
+	assert.Equal(t, "job name must not be empty", err.Error())
+
+	_, err = Run(nil, PushMetrics(server.URL, "job", map[string]float64{"items-total": 1}))
+	assert.Equal(t, "invalid metric name: items-total, must match: ^[a-zA-Z_:][a-zA-Z0-9_:]*$", err.Error())
+}
+
+func TestHTTPStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/events":
+			for _, event := range []string{"data: one", "data: two", "data: three"} {
+				_, _ = w.Write([]byte(event + "\r\n"))
+				w.(http.Flusher).Flush()
+			}
+		case "/tail":
+			_, _ = w.Write([]byte("first\n"))
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	var lines []string
+	collect := func(line string) error {
+		lines = append(lines, line)
+		return nil
+	}
+	got, err := Run(nil, Insert("hello"), HTTPStream(server.URL+"/events", collect))
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", got)
+	assert.Equal(t, []string{"data: one", "data: two", "data: three"}, lines)
+
+	_, err = Run(nil, HTTPStream(server.URL+"/events", func(line string) error {
+		if line == "data: two" {
+			return errors.New("unexpected event")
+		}
+		return nil
+	}))
+	assert.Equal(t, "line 2: unexpected event", err.Error())
+
+	lines = nil
+	_, err = Run(nil, Deadline(100*time.Millisecond, HTTPStream(server.URL+"/tail", collect)))
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Equal(t, []string{"first"}, lines)
+
+	_, err = Run(nil, HTTPStream(server.URL+"/missing", collect))
+	assert.Equal(t, "request responded with status: 404 Not Found, body: 404 page not found", err.Error())
+}
@@ -0,0 +1,140 @@
+package do
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// PipeTimeout runs the commands as a shell pipeline, connecting the stdout of
+// each command to the stdin of the next, and returns the stdout of the last
+// command as []byte. The placeholders of each command are replaced in the
+// same way as Exec does. All commands, and any processes they started, are
+// killed once the chain has run for longer than d, so that a single hung
+// command can't block the pipeline forever. Like with `set -o pipefail`, any
+// failing command fails the stage, the error names the index of the last
+// failing command in the chain.
+func PipeTimeout(d time.Duration, cmds ...string) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		data, ok := input.(interceptExec)
+		if !ok {
+			// Should never reach this point
+			return nil, fmt.Errorf("pipe stage wasn't intercepted")
+		}
+		if len(cmds) == 0 {
+			return nil, fmt.Errorf("no commands provided to pipe")
+		}
+		commands := make([]string, len(cmds))
+		for i, cmd := range cmds {
+			var err error
+			if commands[i], err = InterpolateString(cmd, data.Input, data.Vars); err != nil {
+				return nil, err
+			}
+			ReportProgress(progress, "Piping command %d: %s", i, commands[i])
+		}
+
+		ctx, cancel := context.WithTimeout(contextOf(data), d)
+		defer cancel()
+
+		output, err := doPipe(ctx, progress, commands)
+		if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) && contextOf(data).Err() == nil {
+			return nil, fmt.Errorf("pipe timeout of %s exceeded: %w", d, context.DeadlineExceeded)
+		}
+		return output, err
+	}
+}
+
+// doPipe starts the commands connected by pipes, each in its own process
+// group, and waits for all of them to finish
+func doPipe(ctx context.Context, progress io.Writer, commands []string) (_ []byte, err error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	// The commands write concurrently, each through writers of its own
+	progress = synchronised(progress)
+	var writers []*lineWriter
+	defer func() {
+		for _, w := range writers {
+			_ = w.Flush()
+		}
+	}()
+
+	var outBuff bytes.Buffer
+
+	running := make([]*exec.Cmd, 0, len(commands))
+	defer func() {
+		// Don't leave commands behind when the chain can't be started
+		if err != nil {
+			for _, cmd := range running {
+				_ = killProcessGroup(cmd)
+				_ = cmd.Wait()
+			}
+		}
+	}()
+
+	var stdin io.Reader
+	for i, command := range commands {
+		cmd := exec.CommandContext(ctx, "bash", "-c", command)
+		cmd.Dir = wd
+		cmd.WaitDelay = execWaitDelay
+		setProcessGroup(cmd)
+		cmd.Cancel = func() error {
+			return killProcessGroup(cmd)
+		}
+		cmd.Stdin = stdin
+		stderr := &lineWriter{w: progress}
+		cmd.Stderr = stderr
+		writers = append(writers, stderr)
+
+		var w *os.File
+		if i == len(commands)-1 {
+			stdout := &lineWriter{w: progress}
+			cmd.Stdout = io.MultiWriter(stdout, &outBuff)
+			writers = append(writers, stdout)
+		} else {
+			var r *os.File
+			if r, w, err = os.Pipe(); err != nil {
+				return nil, err
+			}
+			cmd.Stdout = w
+			stdin = r
+		}
+
+		err = cmd.Start()
+		// The started command holds its own copies of the pipe ends
+		if w != nil {
+			_ = w.Close()
+		}
+		if f, ok := cmd.Stdin.(*os.File); ok {
+			_ = f.Close()
+		}
+		if err != nil {
+			if r, ok := stdin.(*os.File); ok && w != nil {
+				_ = r.Close()
+			}
+			return nil, fmt.Errorf("command %d: %w", i, err)
+		}
+		running = append(running, cmd)
+	}
+
+	// Commands before a failing command may be killed by SIGPIPE, report
+	// the last failing command like pipefail does
+	var lastErr error
+	for i, cmd := range running {
+		if werr := cmd.Wait(); werr != nil {
+			lastErr = fmt.Errorf("command %d: %w", i, werr)
+		}
+	}
+	running = nil
+	if lastErr != nil {
+		return nil, lastErr
+	}
+	return outBuff.Bytes(), nil
+}
@@ -0,0 +1,20 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !illumos && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!illumos,!linux,!netbsd,!openbsd,!solaris
+
+package do
+
+import (
+	"os/exec"
+)
+
+// setProcessGroup is a no-op, processes started by the command are not
+// killed along with it on platforms without process groups
+func setProcessGroup(_ *exec.Cmd) {}
+
+// killProcessGroup kills the started command
+func killProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return cmd.Process.Kill()
+}
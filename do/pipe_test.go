@@ -0,0 +1,64 @@
+package do
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPipeTimeout(t *testing.T) {
+	testCases := []struct {
+		name        string
+		stages      []StageFn
+		expect      interface{}
+		expectError bool
+	}{
+		{
+			name: "pipe",
+			stages: []StageFn{
+				Insert("hello"),
+				PipeTimeout(time.Second, `echo "#{content} there"`, "tr a-z A-Z", "tr -d '\n'"),
+			},
+			expect:      []byte("HELLO THERE"),
+			expectError: false,
+		},
+		{
+			name: "pipe failing command",
+			stages: []StageFn{
+				PipeTimeout(time.Second, "echo hello", "exit 3", "cat"),
+			},
+			expect:      fmt.Errorf("command 1: exit status 3"),
+			expectError: true,
+		},
+		{
+			name: "pipe without commands",
+			stages: []StageFn{
+				PipeTimeout(time.Second),
+			},
+			expect:      fmt.Errorf("no commands provided to pipe"),
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		got, err := Run(nil, tc.stages...)
+		if tc.expectError {
+			assert.Equal(t, tc.expect.(error).Error(), err.Error(), tc.name)
+		} else {
+			assert.Equal(t, tc.expect, got, tc.name)
+			assert.Nil(t, err, tc.name)
+		}
+	}
+
+	// The background sleep keeps the output open, it must be killed along
+	// with its process group
+	start := time.Now()
+	_, err := Run(nil, PipeTimeout(100*time.Millisecond, "echo hello", "sleep 10 & cat; wait", "cat"))
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Equal(t, "pipe timeout of 100ms exceeded: context deadline exceeded", err.Error())
+	assert.True(t, time.Since(start) < execWaitDelay)
+}
@@ -0,0 +1,183 @@
+package do
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// syncWriter serialises writes to the progress writer, so that stages
+// running concurrently don't interleave their messages
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(p)
+}
+
+// synchronised wraps the progress writer in a syncWriter, unless it
+// already is one
+func synchronised(progress io.Writer) io.Writer {
+	if _, ok := progress.(*syncWriter); ok {
+		return progress
+	}
+	return &syncWriter{w: progress}
+}
+
+// lineWriter buffers partial lines and only forwards complete lines, in a
+// single write each, it must be flushed once no more content is written
+type lineWriter struct {
+	w   io.Writer
+	buf bytes.Buffer
+}
+
+func (l *lineWriter) Write(p []byte) (int, error) {
+	l.buf.Write(p)
+	if idx := bytes.LastIndexByte(l.buf.Bytes(), '\n'); idx >= 0 {
+		if _, err := l.w.Write(l.buf.Next(idx + 1)); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush forwards any remaining partial line
+func (l *lineWriter) Flush() error {
+	if l.buf.Len() == 0 {
+		return nil
+	}
+	_, err := l.w.Write(l.buf.Next(l.buf.Len()))
+	return err
+}
+
+// ProgressEvent is written as a JSON object per progress message by the
+// writer returned by JSONProgress
+type ProgressEvent struct {
+	Stage     string    `json:"stage"`
+	Index     int       `json:"index"`
+	Message   string    `json:"message"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// stageReporter is implemented by progress writers that describe the stage
+// reporting the progress, Run asks it for a writer for each stage
+type stageReporter interface {
+	forStage(index int, stage string) io.Writer
+}
+
+// jsonProgress writes a ProgressEvent per progress message to w
+type jsonProgress struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// JSONProgress returns a progress writer for Run that writes each progress
+// message to w as a ProgressEvent, one JSON object per line, so that tools
+// wrapping a pipeline can parse its progress. Messages of sub-pipelines are
+// attributed to their own stages. Messages written outside of a stage have
+// an Index of -1.
+func JSONProgress(w io.Writer) io.Writer {
+	return &jsonProgress{w: w}
+}
+
+func (j *jsonProgress) Write(p []byte) (int, error) {
+	return j.write(-1, "", p)
+}
+
+func (j *jsonProgress) forStage(index int, stage string) io.Writer {
+	return &jsonStageWriter{p: j, index: index, stage: stage}
+}
+
+func (j *jsonProgress) write(index int, stage string, p []byte) (int, error) {
+	msg := strings.Trim(string(p), "\n")
+	if msg == "" {
+		return len(p), nil
+	}
+	line, err := json.Marshal(ProgressEvent{
+		Stage:     stage,
+		Index:     index,
+		Message:   msg,
+		Timestamp: time.Now(),
+	})
+	if err != nil {
+		return 0, err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, err := j.w.Write(append(line, '\n')); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// jsonStageWriter attributes progress messages to a stage
+type jsonStageWriter struct {
+	p     *jsonProgress
+	index int
+	stage string
+}
+
+func (j *jsonStageWriter) Write(p []byte) (int, error) {
+	return j.p.write(j.index, j.stage, p)
+}
+
+func (j *jsonStageWriter) forStage(index int, stage string) io.Writer {
+	return j.p.forStage(index, stage)
+}
+
+// maskWriter replaces the matches of the patterns in each write with ***
+type maskWriter struct {
+	w        io.Writer
+	patterns []*regexp.Regexp
+}
+
+// MaskProgress returns a progress writer for Run that redacts each match of
+// the regular expressions in patterns, e.g., a token interpolated into a
+// command, by replacing it with *** before writing to w. Use
+// regexp.QuoteMeta to mask literal values. As it wraps the progress of the
+// whole pipeline, the output of Exec stages is masked as well, which is
+// written line by line, so a match must not span lines. It can wrap the
+// writer returned by JSONProgress.
+func MaskProgress(w io.Writer, patterns ...string) (io.Writer, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, re)
+	}
+	if _, ok := w.(stageReporter); ok {
+		return &maskStageWriter{maskWriter{w: w, patterns: compiled}}, nil
+	}
+	return &maskWriter{w: w, patterns: compiled}, nil
+}
+
+func (m *maskWriter) Write(p []byte) (int, error) {
+	masked := p
+	for _, re := range m.patterns {
+		masked = re.ReplaceAll(masked, []byte("***"))
+	}
+	if _, err := m.w.Write(masked); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// maskStageWriter masks the progress of a stageReporter, passing on the
+// stage reporting it
+type maskStageWriter struct {
+	maskWriter
+}
+
+func (m *maskStageWriter) forStage(index int, stage string) io.Writer {
+	return &maskStageWriter{maskWriter{w: m.w.(stageReporter).forStage(index, stage), patterns: m.patterns}}
+}
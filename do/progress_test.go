@@ -0,0 +1,104 @@
+package do
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProgress(t *testing.T) {
+	var buf bytes.Buffer
+	progress := synchronised(&buf)
+	assert.Equal(t, progress, synchronised(progress))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				ReportProgress(progress, "concurrent message")
+			}
+		}()
+	}
+	wg.Wait()
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		assert.Contains(t, []string{"", "concurrent message"}, line)
+	}
+
+	buf.Reset()
+	var writes []string
+	lw := &lineWriter{w: writerFunc(func(p []byte) (int, error) {
+		writes = append(writes, string(p))
+		return buf.Write(p)
+	})}
+	_, _ = lw.Write([]byte("hel"))
+	_, _ = lw.Write([]byte("lo\nwor"))
+	_, _ = lw.Write([]byte("ld\nagain\nand"))
+	assert.Nil(t, lw.Flush())
+	assert.Equal(t, []string{"hello\n", "world\nagain\n", "and"}, writes)
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+func TestJSONProgress(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := Run(JSONProgress(&buf),
+		Insert("hello"),
+		Deadline(time.Minute, Exec(`echo "#{content}"`)),
+	)
+	assert.Nil(t, err)
+
+	var events []ProgressEvent
+	decoder := json.NewDecoder(&buf)
+	for decoder.More() {
+		var event ProgressEvent
+		assert.Nil(t, decoder.Decode(&event))
+		assert.False(t, event.Timestamp.IsZero())
+		event.Timestamp = time.Time{}
+		events = append(events, event)
+	}
+	assert.Equal(t, []ProgressEvent{
+		{Stage: "do.Insert.func1", Index: 0, Message: "Inserting value into pipeline"},
+		{Stage: "do.Deadline.func1", Index: 1, Message: "Running stages with a deadline of 1m0s"},
+		{Stage: "do.Exec.func1", Index: 0, Message: "Executing command: echo \"hello\""},
+		{Stage: "do.Exec.func1", Index: 0, Message: "hello"},
+	}, events)
+}
+
+func TestMaskProgress(t *testing.T) {
+	var buf bytes.Buffer
+	progress, err := MaskProgress(&buf, regexp.QuoteMeta("s3cr3t"), `ghp_[a-zA-Z0-9]+`)
+	assert.Nil(t, err)
+	_, err = Run(progress,
+		Insert("s3cr3t"),
+		SaveInVar("token"),
+		Exec(`echo "token=#{token}" && echo ghp_abc123 >&2`),
+	)
+	assert.Nil(t, err)
+	assert.Contains(t, buf.String(), "Executing command: echo \"token=***\" && echo *** >&2")
+	assert.Contains(t, buf.String(), "token=***\n")
+	assert.NotContains(t, buf.String(), "s3cr3t")
+	assert.NotContains(t, buf.String(), "ghp_abc123")
+
+	buf.Reset()
+	progress, err = MaskProgress(JSONProgress(&buf), "s3cr3t")
+	assert.Nil(t, err)
+	_, err = Run(progress, Deadline(time.Minute, Exec(`echo s3cr3t`)))
+	assert.Nil(t, err)
+	assert.Contains(t, buf.String(), `"stage":"do.Exec.func1","index":0,"message":"***"`)
+	assert.NotContains(t, buf.String(), "s3cr3t")
+
+	_, err = MaskProgress(&buf, "(")
+	assert.Equal(t, "error parsing regexp: missing closing ): `(`", err.Error())
+}
@@ -0,0 +1,123 @@
+package do
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// readLine reads a single line from the reader one byte at a time, so that
+// nothing beyond the line is consumed from a shared reader like os.Stdin
+func readLine(in io.Reader) (string, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		n, err := in.Read(b)
+		if n > 0 {
+			if b[0] == '\n' {
+				break
+			}
+			line = append(line, b[0])
+		}
+		if err == io.EOF && len(line) > 0 {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read input: %s", err)
+		}
+	}
+	return strings.TrimSuffix(string(line), "\r"), nil
+}
+
+// Prompt writes the message to the progress writer and returns the line
+// entered on os.Stdin as a string, without the trailing newline. This
+// discards the content of the previous stage.
+func Prompt(message string) StageFn {
+	return PromptFrom(os.Stdin, message)
+}
+
+// PromptFrom writes the message to the progress writer and returns the line
+// read from the provided reader as a string, without the trailing newline.
+// Reaching the end of the reader before any input results in an error.
+func PromptFrom(in io.Reader, message string) StageFn {
+	return func(_ interface{}, progress io.Writer) (interface{}, error) {
+		_, _ = io.WriteString(progress, message)
+		return readLine(in)
+	}
+}
+
+// ErrAborted is returned by Confirm when the user declines to continue
+var ErrAborted = errors.New("aborted by user")
+
+type confirmation struct {
+	in         io.Reader
+	defaultYes bool
+	autoYes    bool
+}
+
+// ConfirmOption alters the behaviour of Confirm
+type ConfirmOption func(c *confirmation)
+
+// ConfirmFrom reads the answer from the provided reader instead of os.Stdin
+func ConfirmFrom(in io.Reader) ConfirmOption {
+	return func(c *confirmation) {
+		c.in = in
+	}
+}
+
+// ConfirmDefault sets the answer used when the user enters an empty line,
+// which is no by default
+func ConfirmDefault(yes bool) ConfirmOption {
+	return func(c *confirmation) {
+		c.defaultYes = yes
+	}
+}
+
+// AutoConfirm skips the question and continues when yes is true, e.g., for
+// non-interactive runs in CI
+func AutoConfirm(yes bool) ConfirmOption {
+	return func(c *confirmation) {
+		c.autoYes = yes
+	}
+}
+
+// Confirm asks the user a yes or no question, passing the input of the
+// previous stage on if the answer is yes, or failing the pipeline with
+// ErrAborted if the answer is no. The question is repeated until a valid
+// answer is given.
+func Confirm(message string, opts ...ConfirmOption) StageFn {
+	c := &confirmation{in: os.Stdin}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		if c.autoYes {
+			ReportProgress(progress, "Automatically confirmed: %s", message)
+			return input, nil
+		}
+		choices := "[y/N]"
+		if c.defaultYes {
+			choices = "[Y/n]"
+		}
+		for {
+			_, _ = io.WriteString(progress, fmt.Sprintf("%s %s: ", message, choices))
+			answer, err := readLine(c.in)
+			if err != nil {
+				return nil, err
+			}
+			switch strings.ToLower(strings.TrimSpace(answer)) {
+			case "y", "yes":
+				return input, nil
+			case "n", "no":
+				return nil, ErrAborted
+			case "":
+				if c.defaultYes {
+					return input, nil
+				}
+				return nil, ErrAborted
+			}
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package do
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrompt(t *testing.T) {
+	in := strings.NewReader("bob\r\nalice\nlast")
+
+	testCases := []struct {
+		name        string
+		stages      []StageFn
+		expect      interface{}
+		expectError bool
+	}{
+		{
+			name: "prompt",
+			stages: []StageFn{
+				PromptFrom(in, "Name: "),
+				SaveInVar("first"),
+				PromptFrom(in, "Name: "),
+				Exec(`echo -n "#{first} and #{content}"`),
+			},
+			expect:      []byte("bob and alice"),
+			expectError: false,
+		},
+		{
+			name: "prompt without newline",
+			stages: []StageFn{
+				PromptFrom(in, "Name: "),
+			},
+			expect:      "last",
+			expectError: false,
+		},
+		{
+			name: "prompt eof",
+			stages: []StageFn{
+				PromptFrom(in, "Name: "),
+			},
+			expect:      fmt.Errorf("failed to read input: EOF"),
+			expectError: true,
+		},
+		{
+			name: "confirm yes",
+			stages: []StageFn{
+				Insert("hello"),
+				Confirm("Continue?", ConfirmFrom(strings.NewReader("maybe\nYes\n"))),
+			},
+			expect:      "hello",
+			expectError: false,
+		},
+		{
+			name: "confirm no",
+			stages: []StageFn{
+				Insert("hello"),
+				Confirm("Continue?", ConfirmFrom(strings.NewReader("n\n"))),
+				Exec("echo -n unreachable"),
+			},
+			expect:      ErrAborted,
+			expectError: true,
+		},
+		{
+			name: "confirm default no",
+			stages: []StageFn{
+				Insert("hello"),
+				Confirm("Continue?", ConfirmFrom(strings.NewReader("\n"))),
+			},
+			expect:      ErrAborted,
+			expectError: true,
+		},
+		{
+			name: "confirm default yes",
+			stages: []StageFn{
+				Insert("hello"),
+				Confirm("Continue?", ConfirmFrom(strings.NewReader("\n")), ConfirmDefault(true)),
+			},
+			expect:      "hello",
+			expectError: false,
+		},
+		{
+			name: "confirm auto yes",
+			stages: []StageFn{
+				Insert("hello"),
+				Confirm("Continue?", ConfirmFrom(strings.NewReader("")), AutoConfirm(true)),
+			},
+			expect:      "hello",
+			expectError: false,
+		},
+		{
+			name: "confirm eof",
+			stages: []StageFn{
+				Insert("hello"),
+				Confirm("Continue?", ConfirmFrom(strings.NewReader(""))),
+			},
+			expect:      fmt.Errorf("failed to read input: EOF"),
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		got, err := Run(nil, tc.stages...)
+		if tc.expectError {
+			assert.Equal(t, tc.expect.(error).Error(), err.Error(), tc.name)
+		} else {
+			assert.Equal(t, tc.expect, got, tc.name)
+			assert.Nil(t, err, tc.name)
+		}
+	}
+
+	var progress bytes.Buffer
+	_, _ = Run(&progress, PromptFrom(strings.NewReader("\n"), "Continue? "))
+	assert.Equal(t, "Continue? ", progress.String())
+
+	progress.Reset()
+	_, _ = Run(&progress, Confirm("Continue?", ConfirmFrom(strings.NewReader("y\n")), ConfirmDefault(true)))
+	assert.Equal(t, "Continue? [Y/n]: ", progress.String())
+}
@@ -0,0 +1,26 @@
+package do
+
+import (
+	"fmt"
+	"io"
+
+	"golang.org/x/time/rate"
+)
+
+// RateLimit paces the runs of the wrapped stage to at most rps runs per
+// second, using a token bucket without bursts, waiting as required before
+// each run. The limit is shared by all runs of the returned stage, e.g., for
+// each element of a ForEach over many items that call a rate limited
+// service. Waiting is stopped when the context of the pipeline is done.
+func RateLimit(rps float64, stage StageFn) StageFn {
+	limiter := rate.NewLimiter(rate.Limit(rps), 1)
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		if rps <= 0 {
+			return nil, fmt.Errorf("rate must be positive: %v", rps)
+		}
+		if err := limiter.Wait(contextOf(input)); err != nil {
+			return nil, err
+		}
+		return stage(inputFor(stage, input), progress)
+	}
+}
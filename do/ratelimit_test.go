@@ -0,0 +1,35 @@
+package do
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimit(t *testing.T) {
+	start := time.Now()
+	got, err := Run(nil,
+		Insert([]interface{}{"a", "b", "c"}),
+		ForEach([]StageFn{RateLimit(20, Exec(`echo -n "#{content}"`))}, Concurrency(3)),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{[]byte("a"), []byte("b"), []byte("c")}, got)
+	assert.True(t, time.Since(start) >= 100*time.Millisecond, "runs should be paced")
+
+	_, err = Run(nil, RateLimit(0, Insert("hello")))
+	assert.Equal(t, "rate must be positive: 0", err.Error())
+
+	// Waiting for the next run gives up once the context of the pipeline
+	// can't wait that long
+	limited := RateLimit(0.1, Insert("hello"))
+	_, err = Run(nil, limited)
+	assert.Nil(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start = time.Now()
+	_, err = RunContext(ctx, nil, limited)
+	assert.NotNil(t, err)
+	assert.True(t, time.Since(start) < time.Second)
+}
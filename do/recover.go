@@ -0,0 +1,66 @@
+package do
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"runtime/debug"
+)
+
+// recovering wraps the stage, returning a panic within it as an error
+// prefixed by the provided description of the stage
+func recovering(desc string, stage StageFn) StageFn {
+	return func(input interface{}, progress io.Writer) (output interface{}, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				output = nil
+				err = fmt.Errorf("%s panicked: %v\n%s", desc, r, debug.Stack())
+			}
+		}()
+		return stage(input, progress)
+	}
+}
+
+// runRecovering runs the sub-pipeline in the same way as run, returning a
+// panic within it as an error. Sub-pipelines run on their own goroutine must
+// use it, as a panic there can't be recovered by any stage around them and
+// crashes the program.
+func runRecovering(ctx context.Context, progress io.Writer, input interface{}, vars map[string]interface{}, stages []StageFn) (output interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			output = nil
+			err = fmt.Errorf("sub-pipeline panicked: %v\n%s", r, debug.Stack())
+		}
+	}()
+	return run(ctx, progress, input, vars, stages)
+}
+
+// Safe wraps the stage so that a panic within it is recovered and returned
+// as an error, including the stack trace, instead of crashing the program.
+// Errors returned by the stage itself are passed on unchanged.
+func Safe(stage StageFn) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		return recovering("stage", stage)(inputFor(stage, input), progress)
+	}
+}
+
+type recoverPanicsKey struct{}
+
+// recoversPanics reports whether RecoverPanics was provided to a pipeline
+// that the context was passed down from
+func recoversPanics(ctx context.Context) bool {
+	enabled, _ := ctx.Value(recoverPanicsKey{}).(bool)
+	return enabled
+}
+
+// RecoverPanics enables panic recovery for every stage of the pipeline it
+// is provided to, in the same way as wrapping each stage with Safe, where
+// the error names the stage that panicked. This includes the stages of its
+// sub-pipelines, e.g., of ForEach or Deadline. It passes its input on
+// unchanged.
+// Recovery is off by default, as it adds a deferred function call to every
+// stage, which is cheap compared to most stages, but also hides programming
+// errors that would otherwise crash the program.
+func RecoverPanics(input interface{}, _ io.Writer) (interface{}, error) {
+	return input, nil
+}
@@ -0,0 +1,80 @@
+package do
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Panic(_ interface{}, _ io.Writer) (interface{}, error) {
+	var t *Test
+	return t.Name, nil
+}
+
+func TestRecover(t *testing.T) {
+	testCases := []struct {
+		name        string
+		stages      []StageFn
+		expect      interface{}
+		expectError bool
+	}{
+		{
+			name: "safe",
+			stages: []StageFn{
+				Insert(&Test{Name: "bob"}),
+				Safe(GetName),
+			},
+			expect:      "bob",
+			expectError: false,
+		},
+		{
+			name: "safe exec",
+			stages: []StageFn{
+				Insert("hello"),
+				Safe(Exec(`echo -n "#{content}"`)),
+			},
+			expect:      []byte("hello"),
+			expectError: false,
+		},
+		{
+			name: "safe error",
+			stages: []StageFn{
+				Safe(Exec("exit 2")),
+			},
+			expect:      fmt.Errorf("exit status 2"),
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		got, err := Run(nil, tc.stages...)
+		if tc.expectError {
+			assert.Equal(t, tc.expect.(error).Error(), err.Error(), tc.name)
+		} else {
+			assert.Equal(t, tc.expect, got, tc.name)
+			assert.Nil(t, err, tc.name)
+		}
+	}
+
+	_, err := Run(nil, Safe(Panic))
+	assert.True(t, strings.HasPrefix(err.Error(), "stage panicked: runtime error: invalid memory address or nil pointer dereference\ngoroutine"))
+	assert.Contains(t, err.Error(), "do.Panic(")
+
+	_, err = Run(nil, RecoverPanics, Insert(nil), Panic)
+	assert.True(t, strings.HasPrefix(err.Error(), "stage 2 (do.Panic) panicked: runtime error: invalid memory address or nil pointer dereference\ngoroutine"))
+
+	// Sub-pipelines recover panics as well
+	_, err = Run(nil, RecoverPanics, Deadline(time.Second, Insert(nil), Panic))
+	assert.True(t, strings.HasPrefix(err.Error(), "stage 1 (do.Panic) panicked: "), err.Error())
+
+	_, err = Run(nil, RecoverPanics, Insert([]string{"a"}), ForEach([]StageFn{Insert(nil), Panic}))
+	assert.True(t, strings.HasPrefix(err.Error(), "item 0: stage 1 (do.Panic) panicked: "), err.Error())
+
+	got, err := Run(nil, RecoverPanics, Insert("hello"), Exec(`echo -n "#{content}"`))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("hello"), got)
+}
@@ -0,0 +1,166 @@
+package do
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+)
+
+// itemsOf returns the elements of any slice input as []interface{}
+func itemsOf(input interface{}) ([]interface{}, error) {
+	if items, ok := input.([]interface{}); ok {
+		return items, nil
+	}
+	v := reflect.ValueOf(input)
+	if v.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("provided input must be a slice")
+	}
+	items := make([]interface{}, v.Len())
+	for i := range items {
+		items[i] = v.Index(i).Interface()
+	}
+	return items, nil
+}
+
+// UniqueBy removes the elements of the slice input with a key, as returned
+// by keyFn, that has already been seen, keeping the first occurrence. The
+// remaining elements are returned as []interface{}.
+func UniqueBy(keyFn func(item interface{}) string) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		items, err := itemsOf(input)
+		if err != nil {
+			return nil, err
+		}
+		ReportProgress(progress, "Removing duplicate items")
+
+		seen := map[string]bool{}
+		out := []interface{}{}
+		for _, item := range items {
+			key := keyFn(item)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			out = append(out, item)
+		}
+		return out, nil
+	}
+}
+
+// GroupBy groups the elements of the slice input by their key, as returned
+// by keyFn, into a map[string][]interface{}, e.g., to summarise items by
+// category. The elements of each group keep the order of the input, but as
+// with any map, the iteration order of the groups is random, sort the keys
+// for a stable order.
+func GroupBy(keyFn func(item interface{}) string) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		items, err := itemsOf(input)
+		if err != nil {
+			return nil, err
+		}
+		ReportProgress(progress, "Grouping %d items", len(items))
+
+		groups := map[string][]interface{}{}
+		for _, item := range items {
+			key := keyFn(item)
+			groups[key] = append(groups[key], item)
+		}
+		return groups, nil
+	}
+}
+
+func sortBy(less func(a, b interface{}) bool, stable bool) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		items, err := itemsOf(input)
+		if err != nil {
+			return nil, err
+		}
+		ReportProgress(progress, "Sorting %d items", len(items))
+
+		sorted := make([]interface{}, len(items))
+		copy(sorted, items)
+		lessFn := func(i, j int) bool {
+			return less(sorted[i], sorted[j])
+		}
+		if stable {
+			sort.SliceStable(sorted, lessFn)
+		} else {
+			sort.Slice(sorted, lessFn)
+		}
+		return sorted, nil
+	}
+}
+
+// SortBy returns the elements of the slice input as a sorted []interface{},
+// ordered by the provided less function. The sort is not guaranteed to be
+// stable, see SortStableBy.
+func SortBy(less func(a, b interface{}) bool) StageFn {
+	return sortBy(less, false)
+}
+
+// SortStableBy sorts in the same way as SortBy, but keeps equal elements in
+// their original order.
+func SortStableBy(less func(a, b interface{}) bool) StageFn {
+	return sortBy(less, true)
+}
+
+// isNested reports whether the item is a slice to flatten, []byte is content
+// rather than a collection and is therefore never flattened
+func isNested(item interface{}) bool {
+	if _, ok := item.([]byte); ok {
+		return false
+	}
+	return item != nil && reflect.TypeOf(item).Kind() == reflect.Slice
+}
+
+// Flatten concatenates the elements of the slices of the slice input, e.g.,
+// the [][]interface{} result of nested ForEach stages, into a single
+// []interface{}. Only one level of nesting is removed, see FlattenDeep.
+func Flatten() StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		items, err := itemsOf(input)
+		if err != nil {
+			return nil, err
+		}
+		ReportProgress(progress, "Flattening %d items", len(items))
+
+		out := []interface{}{}
+		for i, item := range items {
+			if !isNested(item) {
+				return nil, fmt.Errorf("item %d: provided input must be a slice of slices", i)
+			}
+			// The item is known to be a slice
+			nested, _ := itemsOf(item)
+			out = append(out, nested...)
+		}
+		return out, nil
+	}
+}
+
+// FlattenDeep concatenates the elements of the slice input, and of any
+// slices nested in it at any depth, into a single []interface{}. Elements
+// that are not slices are kept as is.
+func FlattenDeep() StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		items, err := itemsOf(input)
+		if err != nil {
+			return nil, err
+		}
+		ReportProgress(progress, "Flattening %d items", len(items))
+		return flattenDeep(items, []interface{}{}), nil
+	}
+}
+
+func flattenDeep(items []interface{}, out []interface{}) []interface{} {
+	for _, item := range items {
+		if isNested(item) {
+			// The item is known to be a slice
+			nested, _ := itemsOf(item)
+			out = flattenDeep(nested, out)
+		} else {
+			out = append(out, item)
+		}
+	}
+	return out
+}
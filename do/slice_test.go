@@ -0,0 +1,140 @@
+package do
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlice(t *testing.T) {
+	byName := func(item interface{}) string {
+		return item.(*Test).Name
+	}
+
+	testCases := []struct {
+		name        string
+		stages      []StageFn
+		expect      interface{}
+		expectError bool
+	}{
+		{
+			name: "unique by",
+			stages: []StageFn{
+				Insert([]*Test{{Name: "bob"}, {Name: "alice"}, {Name: "bob"}}),
+				UniqueBy(byName),
+			},
+			expect:      []interface{}{&Test{Name: "bob"}, &Test{Name: "alice"}},
+			expectError: false,
+		},
+		{
+			name: "unique by invalid input",
+			stages: []StageFn{
+				Insert(&Test{Name: "bob"}),
+				UniqueBy(byName),
+			},
+			expect:      fmt.Errorf("provided input must be a slice"),
+			expectError: true,
+		},
+		{
+			name: "sort by",
+			stages: []StageFn{
+				Insert([]*Test{{Name: "bob"}, {Name: "alice"}, {Name: "eve"}}),
+				SortBy(func(a, b interface{}) bool {
+					return byName(a) < byName(b)
+				}),
+			},
+			expect:      []interface{}{&Test{Name: "alice"}, &Test{Name: "bob"}, &Test{Name: "eve"}},
+			expectError: false,
+		},
+		{
+			name: "sort stable by",
+			stages: []StageFn{
+				Insert([]string{"bb", "a", "cc", "d", "aa"}),
+				SortStableBy(func(a, b interface{}) bool {
+					return len(a.(string)) < len(b.(string))
+				}),
+			},
+			expect:      []interface{}{"a", "d", "bb", "cc", "aa"},
+			expectError: false,
+		},
+		{
+			name: "sort by invalid input",
+			stages: []StageFn{
+				Insert(42),
+				SortBy(nil),
+			},
+			expect:      fmt.Errorf("provided input must be a slice"),
+			expectError: true,
+		},
+		{
+			name: "group by",
+			stages: []StageFn{
+				Insert([]string{"apple", "avocado", "banana", "apricot"}),
+				GroupBy(func(item interface{}) string {
+					return item.(string)[:1]
+				}),
+			},
+			expect: map[string][]interface{}{
+				"a": {"apple", "avocado", "apricot"},
+				"b": {"banana"},
+			},
+			expectError: false,
+		},
+		{
+			name: "group by invalid input",
+			stages: []StageFn{
+				Insert("apple"),
+				GroupBy(nil),
+			},
+			expect:      fmt.Errorf("provided input must be a slice"),
+			expectError: true,
+		},
+		{
+			name: "flatten",
+			stages: []StageFn{
+				Insert([][]interface{}{{1, 2}, {}, {[]byte("a"), []int{3}}}),
+				Flatten(),
+			},
+			expect:      []interface{}{1, 2, []byte("a"), []int{3}},
+			expectError: false,
+		},
+		{
+			name: "flatten non-nested",
+			stages: []StageFn{
+				Insert([]interface{}{[]string{"a"}, "b"}),
+				Flatten(),
+			},
+			expect:      fmt.Errorf("item 1: provided input must be a slice of slices"),
+			expectError: true,
+		},
+		{
+			name: "flatten deep",
+			stages: []StageFn{
+				Insert([]interface{}{1, []interface{}{2, [][]int{{3}, {4, 5}}}, []byte("a")}),
+				FlattenDeep(),
+			},
+			expect:      []interface{}{1, 2, 3, 4, 5, []byte("a")},
+			expectError: false,
+		},
+		{
+			name: "flatten deep invalid input",
+			stages: []StageFn{
+				Insert("hello"),
+				FlattenDeep(),
+			},
+			expect:      fmt.Errorf("provided input must be a slice"),
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		got, err := Run(nil, tc.stages...)
+		if tc.expectError {
+			assert.Equal(t, tc.expect.(error).Error(), err.Error(), tc.name)
+		} else {
+			assert.Equal(t, tc.expect, got, tc.name)
+			assert.Nil(t, err, tc.name)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package do
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+)
+
+// ReadFileStream opens fromFile and returns the *os.File, instead of loading
+// its content into memory like ReadFile, so that the stages that support
+// streaming can process files of any size. This discards the content of the
+// previous stage.
+func ReadFileStream(fromFile string) StageFn {
+	return func(_ interface{}, progress io.Writer) (interface{}, error) {
+		ReportProgress(progress, "Opening file for streaming: %s", fromFile)
+		return os.Open(fromFile)
+	}
+}
+
+// StreamToTempFile copies the io.Reader or *os.File input of the previous
+// stage to a temporary file without buffering the content in memory. The
+// temporary file is removed after pipeline completion, a provided reader is
+// consumed but not closed.
+func StreamToTempFile() StageFn {
+	return func(input interface{}, progress io.Writer) (_ interface{}, err error) {
+		var r io.Reader
+		switch data := input.(type) {
+		case *os.File:
+			f, err := os.Open(data.Name())
+			if err != nil {
+				return nil, err
+			}
+			defer func() {
+				_ = f.Close()
+			}()
+			r = f
+		case io.Reader:
+			r = data
+		default:
+			return nil, fmt.Errorf("provided input must be io.Reader or *os.File")
+		}
+
+		var f *os.File
+		if f, err = ioutil.TempFile("", temporaryFilePrefix); err != nil {
+			return nil, err
+		}
+		ReportProgress(progress, "Created temporary file: %s", f.Name())
+
+		n, err := io.Copy(f, r)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			_ = os.Remove(f.Name())
+			return nil, err
+		}
+		ReportProgress(progress, "Streamed %d bytes to temporary file.", n)
+
+		return f, nil
+	}
+}
+
+// ReadN returns up to the first n bytes of the []byte, *os.File or io.Reader
+// input as []byte. If the input holds fewer than n bytes, all of the
+// available bytes are returned. A provided reader is only consumed up to n
+// bytes, leaving the rest unread.
+func ReadN(n int) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		if n < 0 {
+			return nil, fmt.Errorf("number of bytes to read must not be negative: %d", n)
+		}
+		ReportProgress(progress, "Reading the first %d bytes of content", n)
+
+		var r io.Reader
+		switch data := input.(type) {
+		case []byte:
+			if len(data) > n {
+				return data[:n], nil
+			}
+			return data, nil
+		case string:
+			if len(data) > n {
+				return []byte(data[:n]), nil
+			}
+			return []byte(data), nil
+		case *os.File:
+			f, err := os.Open(data.Name())
+			if err != nil {
+				return nil, err
+			}
+			defer func() {
+				_ = f.Close()
+			}()
+			r = f
+		case io.Reader:
+			r = data
+		default:
+			return nil, fmt.Errorf("provided input must be string, []byte, *os.File or io.Reader")
+		}
+
+		buf := make([]byte, n)
+		read, err := io.ReadFull(r, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return nil, err
+		}
+		return buf[:read], nil
+	}
+}
+
+// DetectContentType sniffs the MIME type, e.g., "application/pdf", from the
+// first 512 bytes of the string, []byte or *os.File input and returns it as a
+// string. Shorter content is sniffed as is, and empty content is reported as
+// "text/plain; charset=utf-8".
+func DetectContentType() StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		r, err := readerOf(input)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			_ = r.Close()
+		}()
+
+		buf := make([]byte, 512)
+		n, err := io.ReadFull(r, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return nil, err
+		}
+		contentType := http.DetectContentType(buf[:n])
+		ReportProgress(progress, "Detected content type: %s", contentType)
+		return contentType, nil
+	}
+}
+
+// ErrLimitExceeded is returned when content exceeds the size allowed by
+// LimitBytes
+var ErrLimitExceeded = errors.New("content exceeds size limit")
+
+// limitedReader fails with ErrLimitExceeded instead of silently truncating
+// the content, like io.LimitedReader does, once the limit has been exceeded
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, ErrLimitExceeded
+	}
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n + int(l.remaining), ErrLimitExceeded
+	}
+	return n, err
+}
+
+// LimitBytes fails the pipeline if the string, []byte or *os.File input
+// exceeds max bytes, passing it on unchanged otherwise. An io.Reader input
+// is wrapped so that reading beyond max bytes fails with ErrLimitExceeded.
+func LimitBytes(max int) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		ReportProgress(progress, "Limiting content to %d bytes", max)
+
+		var size int64
+		switch data := input.(type) {
+		case string:
+			size = int64(len(data))
+		case []byte:
+			size = int64(len(data))
+		case *os.File:
+			info, err := os.Stat(data.Name())
+			if err != nil {
+				return nil, err
+			}
+			size = info.Size()
+		case io.Reader:
+			return &limitedReader{r: data, remaining: int64(max)}, nil
+		default:
+			return nil, fmt.Errorf("provided input must be string, []byte, *os.File or io.Reader")
+		}
+		if size > int64(max) {
+			return nil, fmt.Errorf("%w: %d bytes, limit: %d bytes", ErrLimitExceeded, size, max)
+		}
+		return input, nil
+	}
+}
+
+// Chunk splits the string or []byte input into a [][]byte of chunks of size
+// bytes each, where only the last chunk may be smaller. The chunks share the
+// memory of the input.
+func Chunk(size int) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		if size <= 0 {
+			return nil, fmt.Errorf("chunk size must be positive: %d", size)
+		}
+		content, err := contentOf(input)
+		if err != nil {
+			return nil, err
+		}
+		ReportProgress(progress, "Splitting %d bytes into chunks of %d bytes", len(content), size)
+
+		chunks := make([][]byte, 0, (len(content)+size-1)/size)
+		for len(content) > size {
+			chunks = append(chunks, content[:size:size])
+			content = content[size:]
+		}
+		if len(content) > 0 {
+			chunks = append(chunks, content)
+		}
+		return chunks, nil
+	}
+}
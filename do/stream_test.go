@@ -0,0 +1,259 @@
+package do
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStream(t *testing.T) {
+	var tempFile string
+	recordName := func(input interface{}, _ io.Writer) (interface{}, error) {
+		tempFile = input.(*os.File).Name()
+		return input, nil
+	}
+
+	testCases := []struct {
+		name        string
+		stages      []StageFn
+		expect      interface{}
+		expectError bool
+	}{
+		{
+			name: "stream reader to temp file",
+			stages: []StageFn{
+				Insert(strings.NewReader("streamed content")),
+				StreamToTempFile(),
+				recordName,
+				Exec("cat #{file}"),
+			},
+			expect:      []byte("streamed content"),
+			expectError: false,
+		},
+		{
+			name: "stream file to temp file",
+			stages: []StageFn{
+				Insert("from file"),
+				WriteTempFile,
+				StreamToTempFile(),
+				Exec("cat #{file}"),
+			},
+			expect:      []byte("from file"),
+			expectError: false,
+		},
+		{
+			name: "stream invalid input",
+			stages: []StageFn{
+				Insert("not a reader"),
+				StreamToTempFile(),
+			},
+			expect:      fmt.Errorf("provided input must be io.Reader or *os.File"),
+			expectError: true,
+		},
+		{
+			name: "read file stream of missing file",
+			stages: []StageFn{
+				ReadFileStream("/godo/missing/file"),
+			},
+			expect:      fmt.Errorf("open /godo/missing/file: no such file or directory"),
+			expectError: true,
+		},
+		{
+			name: "read n bytes",
+			stages: []StageFn{
+				Insert([]byte("hello there")),
+				ReadN(5),
+			},
+			expect:      []byte("hello"),
+			expectError: false,
+		},
+		{
+			name: "read n bytes of short input",
+			stages: []StageFn{
+				Insert("hi"),
+				ReadN(5),
+			},
+			expect:      []byte("hi"),
+			expectError: false,
+		},
+		{
+			name: "read n bytes of file",
+			stages: []StageFn{
+				Insert("hello there"),
+				WriteTempFile,
+				ReadN(7),
+			},
+			expect:      []byte("hello t"),
+			expectError: false,
+		},
+		{
+			name: "read n bytes of reader",
+			stages: []StageFn{
+				Insert(strings.NewReader("hi")),
+				ReadN(512),
+			},
+			expect:      []byte("hi"),
+			expectError: false,
+		},
+		{
+			name: "detect content type",
+			stages: []StageFn{
+				Insert([]byte("%PDF-1.4 some document")),
+				DetectContentType(),
+			},
+			expect:      "application/pdf",
+			expectError: false,
+		},
+		{
+			name: "detect content type of file",
+			stages: []StageFn{
+				Insert("<html><body>hi</body></html>"),
+				WriteTempFile,
+				DetectContentType(),
+			},
+			expect:      "text/html; charset=utf-8",
+			expectError: false,
+		},
+		{
+			name: "detect content type of empty content",
+			stages: []StageFn{
+				Insert(""),
+				DetectContentType(),
+			},
+			expect:      "text/plain; charset=utf-8",
+			expectError: false,
+		},
+		{
+			name: "limit bytes",
+			stages: []StageFn{
+				Insert("hello"),
+				LimitBytes(5),
+			},
+			expect:      "hello",
+			expectError: false,
+		},
+		{
+			name: "limit bytes exceeded",
+			stages: []StageFn{
+				Exec(`echo -n "hello there"`),
+				LimitBytes(5),
+			},
+			expect:      fmt.Errorf("content exceeds size limit: 11 bytes, limit: 5 bytes"),
+			expectError: true,
+		},
+		{
+			name: "limit bytes of file exceeded",
+			stages: []StageFn{
+				Insert("hello there"),
+				WriteTempFile,
+				LimitBytes(5),
+			},
+			expect:      fmt.Errorf("content exceeds size limit: 11 bytes, limit: 5 bytes"),
+			expectError: true,
+		},
+		{
+			name: "limit bytes of reader",
+			stages: []StageFn{
+				Insert(strings.NewReader("hello")),
+				LimitBytes(5),
+				StreamToTempFile(),
+				Exec("cat #{file}"),
+			},
+			expect:      []byte("hello"),
+			expectError: false,
+		},
+		{
+			name: "limit bytes of reader exceeded",
+			stages: []StageFn{
+				Insert(strings.NewReader("hello there")),
+				LimitBytes(5),
+				StreamToTempFile(),
+			},
+			expect:      ErrLimitExceeded,
+			expectError: true,
+		},
+		{
+			name: "chunk",
+			stages: []StageFn{
+				Insert("hello there"),
+				Chunk(4),
+			},
+			expect:      [][]byte{[]byte("hell"), []byte("o th"), []byte("ere")},
+			expectError: false,
+		},
+		{
+			name: "chunk exact",
+			stages: []StageFn{
+				Insert([]byte("abcd")),
+				Chunk(2),
+			},
+			expect:      [][]byte{[]byte("ab"), []byte("cd")},
+			expectError: false,
+		},
+		{
+			name: "chunk empty",
+			stages: []StageFn{
+				Insert([]byte{}),
+				Chunk(2),
+			},
+			expect:      [][]byte{},
+			expectError: false,
+		},
+		{
+			name: "chunk invalid size",
+			stages: []StageFn{
+				Insert("hello"),
+				Chunk(0),
+			},
+			expect:      fmt.Errorf("chunk size must be positive: 0"),
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		got, err := Run(nil, tc.stages...)
+		if tc.expectError {
+			assert.Equal(t, tc.expect.(error).Error(), err.Error(), tc.name)
+		} else {
+			assert.Equal(t, tc.expect, got, tc.name)
+			assert.Nil(t, err, tc.name)
+		}
+	}
+
+	_, err := os.Stat(tempFile)
+	assert.True(t, os.IsNotExist(err), "temporary file should be removed")
+
+	for _, input := range []interface{}{"hello there", []byte("hello there"), strings.NewReader("hello there")} {
+		_, err = Run(nil, Insert(input), LimitBytes(5), StreamToTempFile())
+		if _, ok := input.(io.Reader); !ok {
+			_, err = Run(nil, Insert(input), LimitBytes(5))
+		}
+		assert.True(t, errors.Is(err, ErrLimitExceeded), "%T", input)
+	}
+}
+
+func TestReadFileStream(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	assert.Nil(t, err)
+	name := filepath.Join(dir, "large")
+	assert.Nil(t, ioutil.WriteFile(name, []byte("hello there"), 0666))
+
+	got, err := Run(nil, ReadFileStream(name))
+	assert.Nil(t, err)
+	assert.Equal(t, name, got.(*os.File).Name())
+	_ = got.(*os.File).Close()
+
+	got, err = Run(nil, ReadFileStream(name), LimitBytes(20), ReadN(5))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("hello"), got)
+}
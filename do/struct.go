@@ -0,0 +1,111 @@
+package do
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// exportedFields returns the names of the exported fields of the struct type
+func exportedFields(t reflect.Type) []string {
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).PkgPath == "" {
+			names = append(names, t.Field(i).Name)
+		}
+	}
+	return names
+}
+
+// Field returns the value of the named exported field of the struct, or
+// pointer to struct, input. Nested fields are selected with a dotted path,
+// e.g., Field("Server.Port").
+func Field(name string) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		ReportProgress(progress, "Selecting field: %s", name)
+		v := reflect.ValueOf(input)
+		for _, part := range strings.Split(name, ".") {
+			for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+				if v.IsNil() {
+					return nil, fmt.Errorf("cannot select field %s of nil value", part)
+				}
+				v = v.Elem()
+			}
+			if v.Kind() != reflect.Struct {
+				return nil, fmt.Errorf("cannot select field %s of non-struct type: %s", part, v.Kind())
+			}
+			f, ok := v.Type().FieldByName(part)
+			if !ok || f.PkgPath != "" {
+				return nil, fmt.Errorf("no exported field %s in %s, available: %s", part, v.Type(), strings.Join(exportedFields(v.Type()), ", "))
+			}
+			var err error
+			// The field may be promoted through a nil embedded pointer
+			if v, err = v.FieldByIndexErr(f.Index); err != nil {
+				return nil, fmt.Errorf("cannot select field %s: %w", part, err)
+			}
+		}
+		return v.Interface(), nil
+	}
+}
+
+// structToMap adds the fields of the struct value to the map, fields of
+// embedded structs are only added when not already defined by the outer
+// struct
+func structToMap(v reflect.Value, m map[string]interface{}, embedded bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := f.Name
+		tagged := false
+		if tag, ok := f.Tag.Lookup("json"); ok {
+			tagName := strings.Split(tag, ",")[0]
+			if tagName == "-" {
+				continue
+			}
+			if tagName != "" {
+				name = tagName
+				tagged = true
+			}
+		}
+		fv := v.Field(i)
+		if f.Anonymous && !tagged {
+			for fv.Kind() == reflect.Ptr && !fv.IsNil() {
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				structToMap(fv, m, true)
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if _, exists := m[name]; exists && embedded {
+			continue
+		}
+		m[name] = fv.Interface()
+	}
+}
+
+// StructToMap converts the struct, or pointer to struct, input into a
+// map[string]interface{} of its exported fields. A field is keyed by the name
+// in its json tag, falling back to the field name when the tag has no name,
+// and skipped when tagged with "-". The fields of embedded structs without a
+// tag name are added to the map directly, where fields of the outer struct
+// take precedence. The field values themselves are not converted.
+func StructToMap() StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		ReportProgress(progress, "Converting struct to map")
+		v := reflect.ValueOf(input)
+		for v.Kind() == reflect.Ptr && !v.IsNil() {
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.Struct {
+			return nil, fmt.Errorf("provided input must be a struct or pointer to struct")
+		}
+		m := map[string]interface{}{}
+		structToMap(v, m, false)
+		return m, nil
+	}
+}
@@ -0,0 +1,161 @@
+package do
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type Server struct {
+	Host string
+	Port int
+}
+
+type Config struct {
+	Name    string `json:"name"`
+	Server  *Server
+	secret  string
+	Enabled bool `json:"enabled,omitempty"`
+}
+
+type Base struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	Ignored string `json:"-"`
+}
+
+type Extended struct {
+	Base
+	ID    string `json:"id"`
+	Name  string
+	Extra *Server `json:"extra"`
+	Plain string  `json:",omitempty"`
+}
+
+type EmbeddedServer struct {
+	*Server
+	Name string
+}
+
+func TestStruct(t *testing.T) {
+	config := &Config{Name: "bob", Server: &Server{Host: "localhost", Port: 80}, secret: "hidden"}
+
+	testCases := []struct {
+		name        string
+		stages      []StageFn
+		expect      interface{}
+		expectError bool
+	}{
+		{
+			name: "field",
+			stages: []StageFn{
+				Insert(config),
+				Field("Name"),
+			},
+			expect:      "bob",
+			expectError: false,
+		},
+		{
+			name: "nested field",
+			stages: []StageFn{
+				Insert(*config),
+				Field("Server.Port"),
+			},
+			expect:      80,
+			expectError: false,
+		},
+		{
+			name: "missing field",
+			stages: []StageFn{
+				Insert(config),
+				Field("secret"),
+			},
+			expect:      fmt.Errorf("no exported field secret in do.Config, available: Name, Server, Enabled"),
+			expectError: true,
+		},
+		{
+			name: "nil nested field",
+			stages: []StageFn{
+				Insert(&Config{}),
+				Field("Server.Host"),
+			},
+			expect:      fmt.Errorf("cannot select field Host of nil value"),
+			expectError: true,
+		},
+		{
+			name: "promoted field",
+			stages: []StageFn{
+				Insert(EmbeddedServer{Server: &Server{Host: "localhost"}}),
+				Field("Host"),
+			},
+			expect:      "localhost",
+			expectError: false,
+		},
+		{
+			name: "field promoted through nil pointer",
+			stages: []StageFn{
+				Insert(EmbeddedServer{Name: "bob"}),
+				Field("Host"),
+			},
+			expect:      fmt.Errorf("cannot select field Host: reflect: indirection through nil pointer to embedded struct field Server"),
+			expectError: true,
+		},
+		{
+			name: "field of non-struct",
+			stages: []StageFn{
+				Insert("bob"),
+				Field("Name"),
+			},
+			expect:      fmt.Errorf("cannot select field Name of non-struct type: string"),
+			expectError: true,
+		},
+		{
+			name: "struct to map",
+			stages: []StageFn{
+				Insert(config),
+				StructToMap(),
+			},
+			expect: map[string]interface{}{
+				"name":    "bob",
+				"Server":  &Server{Host: "localhost", Port: 80},
+				"enabled": false,
+			},
+			expectError: false,
+		},
+		{
+			name: "struct to map embedded",
+			stages: []StageFn{
+				Insert(Extended{Base: Base{ID: 1, Name: "base", Ignored: "x"}, ID: "outer-id", Name: "outer", Plain: "p"}),
+				StructToMap(),
+			},
+			expect: map[string]interface{}{
+				"id":    "outer-id",
+				"name":  "base",
+				"Name":  "outer",
+				"extra": (*Server)(nil),
+				"Plain": "p",
+			},
+			expectError: false,
+		},
+		{
+			name: "struct to map invalid input",
+			stages: []StageFn{
+				Insert([]string{}),
+				StructToMap(),
+			},
+			expect:      fmt.Errorf("provided input must be a struct or pointer to struct"),
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		got, err := Run(nil, tc.stages...)
+		if tc.expectError {
+			assert.Equal(t, tc.expect.(error).Error(), err.Error(), tc.name)
+		} else {
+			assert.Equal(t, tc.expect, got, tc.name)
+			assert.Nil(t, err, tc.name)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package do
+
+import "io"
+
+// SyslogPriority is the severity of the messages written by ToSyslog
+type SyslogPriority int
+
+// The severities of syslog, from most to least severe
+const (
+	SyslogEmerg SyslogPriority = iota
+	SyslogAlert
+	SyslogCrit
+	SyslogErr
+	SyslogWarning
+	SyslogNotice
+	SyslogInfo
+	SyslogDebug
+)
+
+// ToSyslog writes the string or []byte content of the previous stage to the
+// system log, with the user facility, the provided priority and tag, and
+// passes the input on unchanged, e.g., to keep an audit trail of what a
+// pipeline executed. The system log is only supported on unix platforms,
+// elsewhere the stage fails.
+func ToSyslog(tag string, priority SyslogPriority) StageFn {
+	return func(input interface{}, progress io.Writer) (_ interface{}, err error) {
+		content, err := contentOf(input)
+		if err != nil {
+			return nil, err
+		}
+		w, err := newSyslogWriter(priority, tag)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			if cerr := w.Close(); cerr != nil && err == nil {
+				err = cerr
+			}
+		}()
+		ReportProgress(progress, "Writing content to the system log with tag: %s", tag)
+		if _, err := w.Write(content); err != nil {
+			return nil, err
+		}
+		return input, nil
+	}
+}
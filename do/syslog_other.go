@@ -0,0 +1,14 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package do
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+)
+
+var newSyslogWriter = func(_ SyslogPriority, _ string) (io.WriteCloser, error) {
+	return nil, fmt.Errorf("syslog is not supported on platform: %s", runtime.GOOS)
+}
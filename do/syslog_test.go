@@ -0,0 +1,48 @@
+package do
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type syslogBuffer struct {
+	bytes.Buffer
+	priority SyslogPriority
+	tag      string
+	closed   bool
+}
+
+func (s *syslogBuffer) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestToSyslog(t *testing.T) {
+	original := newSyslogWriter
+	defer func() {
+		newSyslogWriter = original
+	}()
+	var buf *syslogBuffer
+	newSyslogWriter = func(priority SyslogPriority, tag string) (io.WriteCloser, error) {
+		buf = &syslogBuffer{priority: priority, tag: tag}
+		return buf, nil
+	}
+
+	got, err := Run(nil, Insert("deployed"), ToSyslog("godo", SyslogNotice))
+	assert.Nil(t, err)
+	assert.Equal(t, "deployed", got)
+	assert.Equal(t, "deployed", buf.String())
+	assert.Equal(t, SyslogNotice, buf.priority)
+	assert.Equal(t, "godo", buf.tag)
+	assert.True(t, buf.closed)
+
+	newSyslogWriter = func(_ SyslogPriority, _ string) (io.WriteCloser, error) {
+		return nil, fmt.Errorf("Unix syslog delivery error")
+	}
+	_, err = Run(nil, Insert("deployed"), ToSyslog("godo", SyslogNotice))
+	assert.Equal(t, "Unix syslog delivery error", err.Error())
+}
@@ -0,0 +1,15 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package do
+
+import (
+	"io"
+	"log/syslog"
+)
+
+// newSyslogWriter connects to the local system log, it is a variable so
+// that tests don't depend on a running syslog daemon
+var newSyslogWriter = func(priority SyslogPriority, tag string) (io.WriteCloser, error) {
+	return syslog.New(syslog.Priority(priority)|syslog.LOG_USER, tag)
+}
@@ -0,0 +1,148 @@
+package do
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+)
+
+func rowsOf(input interface{}) ([][]string, error) {
+	rows, ok := input.([][]string)
+	if !ok {
+		return nil, fmt.Errorf("provided input must be [][]string")
+	}
+	return rows, nil
+}
+
+// SelectColumns picks the provided column indexes, in the given order, from
+// each row of the [][]string input, e.g., as produced by parsing CSV content.
+func SelectColumns(indexes ...int) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		rows, err := rowsOf(input)
+		if err != nil {
+			return nil, err
+		}
+		ReportProgress(progress, "Selecting columns: %v", indexes)
+
+		out := make([][]string, 0, len(rows))
+		for i, row := range rows {
+			selected := make([]string, 0, len(indexes))
+			for _, idx := range indexes {
+				if idx < 0 || idx >= len(row) {
+					return nil, fmt.Errorf("row %d: column index %d out of range, row has %d columns", i+1, idx, len(row))
+				}
+				selected = append(selected, row[idx])
+			}
+			out = append(out, selected)
+		}
+		return out, nil
+	}
+}
+
+// FilterRows keeps the rows of the [][]string input where the cell in the
+// provided column satisfies the predicate, see Equals, Contains and
+// MatchesRegexp for the built-in predicates.
+func FilterRows(col int, pred func(cell string) bool) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		rows, err := rowsOf(input)
+		if err != nil {
+			return nil, err
+		}
+		ReportProgress(progress, "Filtering rows on column: %d", col)
+
+		var out [][]string
+		for i, row := range rows {
+			if col < 0 || col >= len(row) {
+				return nil, fmt.Errorf("row %d: column index %d out of range, row has %d columns", i+1, col, len(row))
+			}
+			if pred(row[col]) {
+				out = append(out, row)
+			}
+		}
+		return out, nil
+	}
+}
+
+// Equals returns a predicate for FilterRows that matches cells equal to value
+func Equals(value string) func(cell string) bool {
+	return func(cell string) bool {
+		return cell == value
+	}
+}
+
+// Contains returns a predicate for FilterRows that matches cells containing
+// the substring
+func Contains(substr string) func(cell string) bool {
+	return func(cell string) bool {
+		return strings.Contains(cell, substr)
+	}
+}
+
+// MatchesRegexp returns a predicate for FilterRows that matches cells against
+// the regular expression, it panics if the expression cannot be compiled.
+func MatchesRegexp(expr string) func(cell string) bool {
+	re := regexp.MustCompile(expr)
+	return func(cell string) bool {
+		return re.MatchString(cell)
+	}
+}
+
+// Table renders the elements of the slice input as an aligned text table,
+// where rowFn returns the cells of the row for each element. The headers are
+// written as the first row, unless empty.
+func Table(headers []string, rowFn func(item interface{}) []string) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		items, err := itemsOf(input)
+		if err != nil {
+			return nil, err
+		}
+		ReportProgress(progress, "Rendering %d items as a table", len(items))
+
+		var buf bytes.Buffer
+		tw := tabwriter.NewWriter(&buf, 0, 8, 2, ' ', 0)
+		if len(headers) > 0 {
+			_, _ = fmt.Fprintln(tw, strings.Join(headers, "\t"))
+		}
+		for _, item := range items {
+			_, _ = fmt.Fprintln(tw, strings.Join(rowFn(item), "\t"))
+		}
+		if err := tw.Flush(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+}
+
+// Columnize arranges the []string input into an aligned text grid of cols
+// columns, filling each row from left to right like `ls -x` does, where the
+// last row holds the remaining items when they don't fill it.
+func Columnize(cols int) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		items, ok := input.([]string)
+		if !ok {
+			return nil, fmt.Errorf("provided input must be []string")
+		}
+		if cols <= 0 {
+			return nil, fmt.Errorf("number of columns must be positive: %d", cols)
+		}
+		ReportProgress(progress, "Arranging %d items in %d columns", len(items), cols)
+
+		var buf bytes.Buffer
+		tw := tabwriter.NewWriter(&buf, 0, 8, 2, ' ', 0)
+		for len(items) > 0 {
+			n := cols
+			if len(items) < n {
+				n = len(items)
+			}
+			_, _ = fmt.Fprintln(tw, strings.Join(items[:n], "\t"))
+			items = items[n:]
+		}
+		if err := tw.Flush(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+}
@@ -0,0 +1,150 @@
+package do
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTable(t *testing.T) {
+	rows := [][]string{
+		{"name", "age", "city"},
+		{"bob", "42", "oslo"},
+		{"alice", "37", "bergen"},
+	}
+
+	testCases := []struct {
+		name        string
+		stages      []StageFn
+		expect      interface{}
+		expectError bool
+	}{
+		{
+			name: "select columns",
+			stages: []StageFn{
+				Insert(rows),
+				SelectColumns(2, 0),
+			},
+			expect: [][]string{
+				{"city", "name"},
+				{"oslo", "bob"},
+				{"bergen", "alice"},
+			},
+			expectError: false,
+		},
+		{
+			name: "select columns out of range",
+			stages: []StageFn{
+				Insert([][]string{{"a", "b"}, {"c"}}),
+				SelectColumns(1),
+			},
+			expect:      fmt.Errorf("row 2: column index 1 out of range, row has 1 columns"),
+			expectError: true,
+		},
+		{
+			name: "select columns invalid input",
+			stages: []StageFn{
+				Insert("a,b"),
+				SelectColumns(0),
+			},
+			expect:      fmt.Errorf("provided input must be [][]string"),
+			expectError: true,
+		},
+		{
+			name: "filter rows equals",
+			stages: []StageFn{
+				Insert(rows),
+				FilterRows(0, Equals("bob")),
+			},
+			expect:      [][]string{{"bob", "42", "oslo"}},
+			expectError: false,
+		},
+		{
+			name: "filter rows contains",
+			stages: []StageFn{
+				Insert(rows),
+				FilterRows(2, Contains("er")),
+			},
+			expect:      [][]string{{"alice", "37", "bergen"}},
+			expectError: false,
+		},
+		{
+			name: "filter rows regexp",
+			stages: []StageFn{
+				Insert(rows),
+				FilterRows(1, MatchesRegexp("^[0-9]+$")),
+				SelectColumns(0),
+			},
+			expect:      [][]string{{"bob"}, {"alice"}},
+			expectError: false,
+		},
+		{
+			name: "filter rows out of range",
+			stages: []StageFn{
+				Insert(rows),
+				FilterRows(3, Equals("")),
+			},
+			expect:      fmt.Errorf("row 1: column index 3 out of range, row has 3 columns"),
+			expectError: true,
+		},
+		{
+			name: "table",
+			stages: []StageFn{
+				Insert([]*Test{{Name: "bob"}, {Name: "alice"}}),
+				Table([]string{"NAME", "LENGTH"}, func(item interface{}) []string {
+					name := item.(*Test).Name
+					return []string{name, fmt.Sprint(len(name))}
+				}),
+			},
+			expect:      []byte("NAME   LENGTH\nbob    3\nalice  5\n"),
+			expectError: false,
+		},
+		{
+			name: "table invalid input",
+			stages: []StageFn{
+				Insert("bob"),
+				Table(nil, nil),
+			},
+			expect:      fmt.Errorf("provided input must be a slice"),
+			expectError: true,
+		},
+		{
+			name: "columnize",
+			stages: []StageFn{
+				Insert([]string{"bin", "Documents", "go", "lib", "tmp"}),
+				Columnize(3),
+			},
+			expect:      []byte("bin  Documents  go\nlib  tmp\n"),
+			expectError: false,
+		},
+		{
+			name: "columnize empty",
+			stages: []StageFn{
+				Insert([]string{}),
+				Columnize(3),
+			},
+			expect:      []byte(nil),
+			expectError: false,
+		},
+		{
+			name: "columnize invalid columns",
+			stages: []StageFn{
+				Insert([]string{"bin"}),
+				Columnize(0),
+			},
+			expect:      fmt.Errorf("number of columns must be positive: 0"),
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		got, err := Run(nil, tc.stages...)
+		if tc.expectError {
+			assert.Equal(t, tc.expect.(error).Error(), err.Error(), tc.name)
+		} else {
+			assert.Equal(t, tc.expect, got, tc.name)
+			assert.Nil(t, err, tc.name)
+		}
+	}
+}
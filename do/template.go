@@ -0,0 +1,167 @@
+package do
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// Interpolate replaces the placeholders of the template in the same way as
+// Exec does for its command, and returns the result as []byte
+func Interpolate(tmpl string) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		data, ok := input.(interceptExec)
+		if !ok {
+			// Should never reach this point
+			return nil, fmt.Errorf("interpolate stage wasn't intercepted")
+		}
+		content, err := InterpolateString(tmpl, data.Input, data.Vars)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(content), nil
+	}
+}
+
+// ExpandOption configures ExpandVars
+type ExpandOption func(e *expansion)
+
+type expansion struct {
+	errorOnUndefined bool
+}
+
+// ErrorOnUndefined fails ExpandVars when a placeholder references a
+// variable that doesn't exist, instead of leaving the placeholder as is
+func ErrorOnUndefined(e *expansion) {
+	e.errorOnUndefined = true
+}
+
+// varPlaceholder matches the ${name} and $name placeholders of ExpandVars
+var varPlaceholder = regexp.MustCompile(`\$\{([a-zA-Z_][a-zA-Z0-9_]*)\}|\$([a-zA-Z_][a-zA-Z0-9_]*)`)
+
+// ExpandVars replaces the ${name} and $name placeholders of the string or
+// []byte input with the variables of the pipeline, and returns the result
+// with the type of the input. Variables that are not a string, []byte or
+// *os.File are formatted with fmt. Placeholders of undefined variables, and
+// any other use of $, e.g., $5, are left as is, unless ErrorOnUndefined is
+// provided.
+func ExpandVars(opts ...ExpandOption) StageFn {
+	e := &expansion{}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		data, ok := input.(interceptExec)
+		if !ok {
+			// Should never reach this point
+			return nil, fmt.Errorf("expand vars stage wasn't intercepted")
+		}
+		content, err := contentOf(data.Input)
+		if err != nil {
+			return nil, err
+		}
+
+		var undefined []string
+		expanded := varPlaceholder.ReplaceAllStringFunc(string(content), func(placeholder string) string {
+			name := strings.Trim(placeholder, "${}")
+			switch v := data.Vars[name].(type) {
+			case nil:
+				undefined = append(undefined, name)
+				return placeholder
+			case string:
+				return v
+			case []byte:
+				return string(v)
+			case *os.File:
+				return v.Name()
+			default:
+				return fmt.Sprint(v)
+			}
+		})
+		if e.errorOnUndefined && len(undefined) > 0 {
+			return nil, fmt.Errorf("undefined variables: %s", strings.Join(undefined, ", "))
+		}
+		if _, ok := data.Input.(string); ok {
+			return expanded, nil
+		}
+		return []byte(expanded), nil
+	}
+}
+
+var secretRef = regexp.MustCompile(`secret://[a-zA-Z0-9_./-]+`)
+
+// ResolveSecrets replaces each secret://name reference in the string or
+// []byte input with the value lookup returns for name, e.g., from Vault, the
+// environment or a file, and returns the result with the type of the input.
+// This keeps secrets out of the definition of the pipeline. The lookup is
+// called once per distinct reference, any reference it fails to resolve
+// fails the stage, naming the reference but never a value.
+func ResolveSecrets(lookup func(ref string) (string, error)) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		content, err := contentOf(input)
+		if err != nil {
+			return nil, err
+		}
+
+		resolved := map[string]string{}
+		var failed []string
+		for _, ref := range secretRef.FindAllString(string(content), -1) {
+			if _, ok := resolved[ref]; ok {
+				continue
+			}
+			value, err := lookup(strings.TrimPrefix(ref, "secret://"))
+			if err != nil {
+				failed = append(failed, fmt.Sprintf("%s (%s)", ref, err))
+			}
+			resolved[ref] = value
+		}
+		if len(failed) > 0 {
+			return nil, fmt.Errorf("unresolvable secrets: %s", strings.Join(failed, ", "))
+		}
+		ReportProgress(progress, "Resolved %d secrets", len(resolved))
+
+		out := secretRef.ReplaceAllStringFunc(string(content), func(ref string) string {
+			return resolved[ref]
+		})
+		if _, ok := input.(string); ok {
+			return out, nil
+		}
+		return []byte(out), nil
+	}
+}
+
+// RenderToFiles renders the text/template for each item of the []interface{}
+// input and writes the result to the file name returned by nameFn for that
+// item. The names of the created files are returned.
+func RenderToFiles(tmpl string, nameFn func(item interface{}) string) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		items, ok := input.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("provided input must be []interface{}")
+		}
+		t, err := template.New("render").Parse(tmpl)
+		if err != nil {
+			return nil, err
+		}
+
+		var created []string
+		for i, item := range items {
+			var buf bytes.Buffer
+			if err := t.Execute(&buf, item); err != nil {
+				return created, fmt.Errorf("item %d (%v): %s", i, item, err)
+			}
+			name := nameFn(item)
+			ReportProgress(progress, "Rendering item %d to file: %s", i, name)
+			if err := ioutil.WriteFile(name, buf.Bytes(), 0666); err != nil {
+				return created, fmt.Errorf("item %d (%v): %s", i, item, err)
+			}
+			created = append(created, name)
+		}
+		return created, nil
+	}
+}
@@ -0,0 +1,191 @@
+package do
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	assert.Nil(t, err)
+
+	nameFn := func(item interface{}) string {
+		return path.Join(dir, item.(*Test).Name+".txt")
+	}
+
+	secrets := func(ref string) (string, error) {
+		switch ref {
+		case "db/password":
+			return "s3cr3t", nil
+		case "api.token":
+			return "t0k3n", nil
+		default:
+			return "", fmt.Errorf("no such secret")
+		}
+	}
+
+	testCases := []struct {
+		name        string
+		stages      []StageFn
+		expect      interface{}
+		expectError bool
+	}{
+		{
+			name: "interpolate",
+			stages: []StageFn{
+				Insert("bob"),
+				SaveInVar("name"),
+				Insert("hello"),
+				Interpolate("#{content} #{name}, #{missing}"),
+			},
+			expect:      []byte("hello bob, #{missing}"),
+			expectError: false,
+		},
+		{
+			name: "interpolate file",
+			stages: []StageFn{
+				Insert("hello"),
+				WriteFile(path.Join(dir, "greeting")),
+				Interpolate("cat #{file}"),
+			},
+			expect:      []byte("cat " + path.Join(dir, "greeting")),
+			expectError: false,
+		},
+		{
+			name: "interpolate unsupported variable",
+			stages: []StageFn{
+				Insert(42),
+				SaveInVar("answer"),
+				Interpolate("#{answer}"),
+			},
+			expect:      fmt.Errorf("don't know how to replace content, required: string, []byte or *os.File"),
+			expectError: true,
+		},
+		{
+			name: "expand vars",
+			stages: []StageFn{
+				Insert("bob"),
+				SaveInVar("name"),
+				Insert(42),
+				SaveInVar("answer"),
+				Insert("hello ${name}, $answer${missing}"),
+				ExpandVars(),
+			},
+			expect:      "hello bob, 42${missing}",
+			expectError: false,
+		},
+		{
+			name: "expand vars literal dollar",
+			stages: []StageFn{
+				Insert("bob"),
+				SaveInVar("name"),
+				Insert("costs $5 for ${name}, $ or $$"),
+				ExpandVars(),
+			},
+			expect:      "costs $5 for bob, $ or $$",
+			expectError: false,
+		},
+		{
+			name: "expand vars unknown left as is",
+			stages: []StageFn{
+				Insert("costs $5 for ${name}"),
+				ExpandVars(),
+			},
+			expect:      "costs $5 for ${name}",
+			expectError: false,
+		},
+		{
+			name: "expand vars bytes",
+			stages: []StageFn{
+				Insert("bob"),
+				SaveInVar("name"),
+				Insert([]byte("hello ${name}")),
+				ExpandVars(ErrorOnUndefined),
+			},
+			expect:      []byte("hello bob"),
+			expectError: false,
+		},
+		{
+			name: "expand vars undefined",
+			stages: []StageFn{
+				Insert("hello ${name} $other costs $5"),
+				ExpandVars(ErrorOnUndefined),
+			},
+			expect:      fmt.Errorf("undefined variables: name, other"),
+			expectError: true,
+		},
+		{
+			name: "render to files",
+			stages: []StageFn{
+				Insert([]interface{}{&Test{Name: "bob"}, &Test{Name: "alice"}}),
+				RenderToFiles("hello {{ .Name }}", nameFn),
+			},
+			expect:      []string{path.Join(dir, "bob.txt"), path.Join(dir, "alice.txt")},
+			expectError: false,
+		},
+		{
+			name: "render to files and read",
+			stages: []StageFn{
+				Insert([]interface{}{&Test{Name: "eve"}}),
+				RenderToFiles("hello {{ .Name }}", nameFn),
+				ReadFile(path.Join(dir, "eve.txt")),
+			},
+			expect:      []byte("hello eve"),
+			expectError: false,
+		},
+		{
+			name: "render to files failing item",
+			stages: []StageFn{
+				Insert([]interface{}{&Test{Name: "bob"}}),
+				RenderToFiles("hello {{ .Missing }}", nameFn),
+			},
+			expect:      fmt.Errorf(`item 0 (&{bob}): template: render:1:9: executing "render" at <.Missing>: can't evaluate field Missing in type *do.Test`),
+			expectError: true,
+		},
+		{
+			name: "resolve secrets",
+			stages: []StageFn{
+				Insert("postgres://app:secret://db/password@db, token=secret://api.token, again=secret://db/password"),
+				ResolveSecrets(secrets),
+			},
+			expect:      "postgres://app:s3cr3t@db, token=t0k3n, again=s3cr3t",
+			expectError: false,
+		},
+		{
+			name: "resolve secrets bytes",
+			stages: []StageFn{
+				Insert([]byte("token: secret://api.token")),
+				ResolveSecrets(secrets),
+			},
+			expect:      []byte("token: t0k3n"),
+			expectError: false,
+		},
+		{
+			name: "resolve secrets unresolvable",
+			stages: []StageFn{
+				Insert("secret://db/password secret://missing secret://other"),
+				ResolveSecrets(secrets),
+			},
+			expect:      fmt.Errorf("unresolvable secrets: secret://missing (no such secret), secret://other (no such secret)"),
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		got, err := Run(nil, tc.stages...)
+		if tc.expectError {
+			assert.Equal(t, tc.expect.(error).Error(), err.Error(), tc.name)
+		} else {
+			assert.Equal(t, tc.expect, got, tc.name)
+			assert.Nil(t, err, tc.name)
+		}
+	}
+}
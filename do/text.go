@@ -0,0 +1,482 @@
+package do
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ansiEscapeSequence matches ANSI escape sequences, such as colour codes and
+// cursor movements, as emitted by many command line tools
+var ansiEscapeSequence = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(\x07|\x1b\\)|\x1b[@-Z\\-_]`)
+
+// StripANSI removes any ANSI escape sequences from the content of the previous
+// stage, this is useful for cleaning up colourised output from an Exec stage.
+func StripANSI() StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		content, err := contentOf(input)
+		if err != nil {
+			return nil, err
+		}
+		ReportProgress(progress, "Stripping ANSI escape sequences from content")
+		return ansiEscapeSequence.ReplaceAllString(string(content), ""), nil
+	}
+}
+
+// FieldOption configures FilterByField
+type FieldOption func(f *fieldFilter)
+
+type fieldFilter struct {
+	errorOnNonNumeric bool
+}
+
+// ErrorOnNonNumeric fails FilterByField on a line where the field is
+// missing or not a number, instead of skipping the line
+func ErrorOnNonNumeric(f *fieldFilter) {
+	f.errorOnNonNumeric = true
+}
+
+// ColumnOption configures Column
+type ColumnOption func(c *columnExtraction)
+
+type columnExtraction struct {
+	skipMissingFields bool
+}
+
+// SkipMissingFields makes Column skip lines that don't have the field,
+// instead of emitting an empty line
+func SkipMissingFields(c *columnExtraction) {
+	c.skipMissingFields = true
+}
+
+// fieldsOf splits the line by fieldSep, or by whitespace if fieldSep is empty
+func fieldsOf(line, fieldSep string) []string {
+	if fieldSep == "" {
+		return strings.Fields(line)
+	}
+	return strings.Split(line, fieldSep)
+}
+
+// comparisons are the operators supported by FilterByField
+var comparisons = map[string]func(a, b float64) bool{
+	"<":  func(a, b float64) bool { return a < b },
+	"<=": func(a, b float64) bool { return a <= b },
+	">":  func(a, b float64) bool { return a > b },
+	">=": func(a, b float64) bool { return a >= b },
+	"==": func(a, b float64) bool { return a == b },
+	"!=": func(a, b float64) bool { return a != b },
+}
+
+// FilterByField splits the content of the previous stage into lines by the
+// separator, and each line into fields by fieldSep, or by whitespace if
+// fieldSep is empty. Lines are kept when the zero based field, parsed as a
+// number, compares to value by op: <, <=, >, >=, == or !=. Lines where the
+// field is missing or not a number are skipped, unless ErrorOnNonNumeric is
+// provided, and empty lines are always skipped. The kept lines are joined
+// by the separator and returned as string.
+func FilterByField(separator, fieldSep string, fieldIndex int, op string, value float64, opts ...FieldOption) StageFn {
+	f := &fieldFilter{}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		compare, ok := comparisons[op]
+		if !ok {
+			return nil, fmt.Errorf("unknown comparison operator: %s", op)
+		}
+		content, err := contentOf(input)
+		if err != nil {
+			return nil, err
+		}
+		ReportProgress(progress, "Filtering lines where field %d %s %v", fieldIndex, op, value)
+
+		var out []string
+		for i, line := range strings.Split(string(content), separator) {
+			if line == "" {
+				continue
+			}
+			fields := fieldsOf(line, fieldSep)
+			if fieldIndex < 0 || fieldIndex >= len(fields) {
+				if f.errorOnNonNumeric {
+					return nil, fmt.Errorf("line %d has no field %d: %s", i+1, fieldIndex, line)
+				}
+				continue
+			}
+			n, err := strconv.ParseFloat(strings.TrimSpace(fields[fieldIndex]), 64)
+			if err != nil {
+				if f.errorOnNonNumeric {
+					return nil, fmt.Errorf("line %d: %s", i+1, err)
+				}
+				continue
+			}
+			if compare(n, value) {
+				out = append(out, line)
+			}
+		}
+		result := strings.Join(out, separator)
+		if len(out) > 0 && separator != "" && bytes.HasSuffix(content, []byte(separator)) {
+			// Keep the trailing separator of the input, as Column does
+			result += separator
+		}
+		return result, nil
+	}
+}
+
+// Column splits the content of the previous stage into lines by the
+// separator, and returns the zero based field of each line, split by
+// fieldSep, or by whitespace if fieldSep is empty, joined by the separator
+// as string. A negative index counts from the last field, e.g., -1. Lines
+// without the field result in an empty line, unless SkipMissingFields is
+// provided.
+func Column(separator, fieldSep string, index int, opts ...ColumnOption) StageFn {
+	c := &columnExtraction{}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		content, err := contentOf(input)
+		if err != nil {
+			return nil, err
+		}
+		ReportProgress(progress, "Extracting field %d of each line", index)
+
+		var out []string
+		for _, line := range strings.Split(string(content), separator) {
+			fields := fieldsOf(line, fieldSep)
+			i := index
+			if i < 0 {
+				i += len(fields)
+			}
+			if i < 0 || i >= len(fields) {
+				if !c.skipMissingFields {
+					out = append(out, "")
+				}
+				continue
+			}
+			out = append(out, fields[i])
+		}
+		return strings.Join(out, separator), nil
+	}
+}
+
+// LineCount is the number of occurrences of a line, as returned by
+// CountUnique
+type LineCount struct {
+	Line  string
+	Count int
+}
+
+// CountOption configures CountUnique
+type CountOption func(c *counting)
+
+type counting struct {
+	sortByCount bool
+}
+
+// SortByCount orders the result of CountUnique by descending count,
+// instead of by line
+func SortByCount(c *counting) {
+	c.sortByCount = true
+}
+
+// CountUnique splits the content of the previous stage into lines by the
+// separator, and returns how often each distinct line occurs as a
+// []LineCount, ordered by line, or by descending count if SortByCount is
+// provided. Empty lines are not counted.
+func CountUnique(separator string, opts ...CountOption) StageFn {
+	c := &counting{}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		content, err := contentOf(input)
+		if err != nil {
+			return nil, err
+		}
+		ReportProgress(progress, "Counting unique lines")
+
+		counts := make(map[string]int)
+		for _, line := range strings.Split(string(content), separator) {
+			if line != "" {
+				counts[line]++
+			}
+		}
+		result := make([]LineCount, 0, len(counts))
+		for line, count := range counts {
+			result = append(result, LineCount{Line: line, Count: count})
+		}
+
+		sort.Slice(result, func(i, j int) bool {
+			if c.sortByCount && result[i].Count != result[j].Count {
+				return result[i].Count > result[j].Count
+			}
+			return result[i].Line < result[j].Line
+		})
+		return result, nil
+	}
+}
+
+// Bytes applies fn to the string or []byte content of the previous stage,
+// and returns its result, so that custom transformations don't have to
+// handle the type of the input themselves.
+func Bytes(fn func([]byte) ([]byte, error)) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		content, err := contentOf(input)
+		if err != nil {
+			return nil, err
+		}
+		return fn(content)
+	}
+}
+
+// Str applies fn to the string or []byte content of the previous stage as
+// string, and returns its result, in the same way as Bytes.
+func Str(fn func(string) (string, error)) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		content, err := contentOf(input)
+		if err != nil {
+			return nil, err
+		}
+		return fn(string(content))
+	}
+}
+
+// NormalizeLineEndings converts the line endings of the string or []byte
+// content of the previous stage to the style, either "lf" or "crlf", and
+// returns the result as []byte. Content that already uses the style is
+// returned without being copied.
+func NormalizeLineEndings(style string) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		if style != "lf" && style != "crlf" {
+			return nil, fmt.Errorf("unknown line ending style: %s, supported: lf, crlf", style)
+		}
+		content, err := contentOf(input)
+		if err != nil {
+			return nil, err
+		}
+		crlf := bytes.Count(content, []byte("\r\n"))
+		if style == "lf" {
+			if crlf == 0 {
+				return content, nil
+			}
+			return bytes.Replace(content, []byte("\r\n"), []byte("\n"), -1), nil
+		}
+		if crlf == bytes.Count(content, []byte("\n")) {
+			return content, nil
+		}
+		content = bytes.Replace(content, []byte("\r\n"), []byte("\n"), -1)
+		return bytes.Replace(content, []byte("\n"), []byte("\r\n"), -1), nil
+	}
+}
+
+// WrapLines wraps each line of the string or []byte content of the previous
+// stage at word boundaries, so that no line is longer than width characters,
+// and returns the result as string. Existing line breaks are preserved,
+// words longer than width are broken up, and the whitespace between words of
+// a line is collapsed into single spaces.
+func WrapLines(width int) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		if width < 1 {
+			return nil, fmt.Errorf("width must be at least 1, got: %d", width)
+		}
+		content, err := contentOf(input)
+		if err != nil {
+			return nil, err
+		}
+
+		var out []string
+		for _, line := range strings.Split(string(content), "\n") {
+			var current []rune
+			wrapped := false
+			for _, word := range strings.Fields(line) {
+				w := []rune(word)
+				if len(current) > 0 && len(current)+1+len(w) <= width {
+					current = append(append(current, ' '), w...)
+					continue
+				}
+				if len(current) > 0 {
+					out = append(out, string(current))
+					wrapped = true
+				}
+				for len(w) > width {
+					out = append(out, string(w[:width]))
+					wrapped = true
+					w = w[width:]
+				}
+				current = w
+			}
+			if len(current) > 0 || !wrapped {
+				out = append(out, string(current))
+			}
+		}
+		return strings.Join(out, "\n"), nil
+	}
+}
+
+// ExtractAll returns the capture group of each match of the regular
+// expression in the string or []byte content of the previous stage as
+// []string, where group 0 is the whole match.
+func ExtractAll(pattern string, group int) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if group < 0 || group > re.NumSubexp() {
+			return nil, fmt.Errorf("group %d out of range, pattern has %d groups", group, re.NumSubexp())
+		}
+		content, err := contentOf(input)
+		if err != nil {
+			return nil, err
+		}
+		ReportProgress(progress, "Extracting group %d of matches: %s", group, pattern)
+
+		extracted := []string{}
+		for _, match := range re.FindAllSubmatch(content, -1) {
+			extracted = append(extracted, string(match[group]))
+		}
+		return extracted, nil
+	}
+}
+
+var varRef = regexp.MustCompile(`^#\{([a-zA-Z]+)\}$`)
+
+// SetOp combines the lines of the string or []byte content of the previous
+// stage, as the first set, with the lines of other, as the second set, by
+// op: intersect, union or difference, like comm does, e.g., to compare two
+// directory listings. The other set is read from the file at the path
+// other, or from the variable name when other is #{name}. Empty lines are
+// ignored, and each line is only kept once, in the order it appears first.
+// The resulting lines are joined by newlines and returned as string.
+func SetOp(op string, other string) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		data, ok := input.(interceptExec)
+		if !ok {
+			// Should never reach this point
+			return nil, fmt.Errorf("set op stage wasn't intercepted")
+		}
+		if op != "intersect" && op != "union" && op != "difference" {
+			return nil, fmt.Errorf("unknown set operation: %s, supported: intersect, union, difference", op)
+		}
+		first, err := contentOf(data.Input)
+		if err != nil {
+			return nil, err
+		}
+		var second []byte
+		if m := varRef.FindStringSubmatch(other); m != nil {
+			v, ok := data.Vars[m[1]]
+			if !ok {
+				return nil, fmt.Errorf("variable: %s doesn't exist", m[1])
+			}
+			if f, ok := v.(*os.File); ok {
+				second, err = ioutil.ReadFile(f.Name())
+			} else {
+				second, err = contentOf(v)
+			}
+		} else {
+			second, err = ioutil.ReadFile(other)
+		}
+		if err != nil {
+			return nil, err
+		}
+		ReportProgress(progress, "Computing %s of lines with: %s", op, other)
+
+		inSecond := map[string]bool{}
+		for _, line := range strings.Split(string(second), "\n") {
+			inSecond[strings.TrimSuffix(line, "\r")] = true
+		}
+		seen := map[string]bool{"": true}
+		var out []string
+		add := func(line string) {
+			if !seen[line] {
+				seen[line] = true
+				out = append(out, line)
+			}
+		}
+		for _, line := range strings.Split(string(first), "\n") {
+			line = strings.TrimSuffix(line, "\r")
+			switch op {
+			case "intersect":
+				if inSecond[line] {
+					add(line)
+				}
+			case "difference":
+				if !inSecond[line] {
+					add(line)
+				}
+			default:
+				add(line)
+			}
+		}
+		if op == "union" {
+			for _, line := range strings.Split(string(second), "\n") {
+				add(strings.TrimSuffix(line, "\r"))
+			}
+		}
+		return strings.Join(out, "\n"), nil
+	}
+}
+
+// MatchOption configures ParseNamed
+type MatchOption func(m *matching)
+
+type matching struct {
+	errorOnMismatch bool
+}
+
+// ErrorOnMismatch fails ParseNamed on a line that doesn't match the
+// regular expression, instead of skipping the line
+func ErrorOnMismatch(m *matching) {
+	m.errorOnMismatch = true
+}
+
+// ParseNamed matches each line of the string or []byte content of the
+// previous stage against the regular expression, and returns the named
+// capture groups of each matching line as []map[string]string, keyed by
+// group name. Lines that don't match are skipped, unless ErrorOnMismatch is
+// provided, and empty lines are always skipped.
+func ParseNamed(pattern string, opts ...MatchOption) StageFn {
+	m := &matching{}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		content, err := contentOf(input)
+		if err != nil {
+			return nil, err
+		}
+		ReportProgress(progress, "Parsing lines with pattern: %s", pattern)
+
+		parsed := []map[string]string{}
+		for i, line := range strings.Split(string(content), "\n") {
+			if line == "" {
+				continue
+			}
+			match := re.FindStringSubmatch(line)
+			if match == nil {
+				if m.errorOnMismatch {
+					return nil, fmt.Errorf("line %d doesn't match pattern: %s", i+1, line)
+				}
+				continue
+			}
+			fields := map[string]string{}
+			for j, name := range re.SubexpNames() {
+				if name != "" {
+					fields[name] = match[j]
+				}
+			}
+			parsed = append(parsed, fields)
+		}
+		return parsed, nil
+	}
+}
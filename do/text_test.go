@@ -0,0 +1,418 @@
+package do
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestText(t *testing.T) {
+	testCases := []struct {
+		name        string
+		stages      []StageFn
+		expect      interface{}
+		expectError bool
+	}{
+		{
+			name: "strip ansi",
+			stages: []StageFn{
+				Exec(`printf "\033[1;31mred\033[0m and \033[32mgreen\033[0m"`),
+				StripANSI(),
+			},
+			expect:      "red and green",
+			expectError: false,
+		},
+		{
+			name: "strip ansi invalid input",
+			stages: []StageFn{
+				Insert(42),
+				StripANSI(),
+			},
+			expect:      fmt.Errorf("provided input must be string or []byte"),
+			expectError: true,
+		},
+		{
+			name: "filter by field",
+			stages: []StageFn{
+				Insert("alice 42\nbob 7\ncarol n/a\ndave\n\n"),
+				FilterByField("\n", "", 1, ">=", 10),
+			},
+			expect:      "alice 42\n",
+			expectError: false,
+		},
+		{
+			name: "filter by field separator",
+			stages: []StageFn{
+				Insert("a,1.5\nb,2\nc,1.5"),
+				FilterByField("\n", ",", 1, "==", 1.5),
+			},
+			expect:      "a,1.5\nc,1.5",
+			expectError: false,
+		},
+		{
+			name: "filter by field non-numeric",
+			stages: []StageFn{
+				Insert("alice 42\ncarol n/a"),
+				FilterByField("\n", "", 1, ">", 0, ErrorOnNonNumeric),
+			},
+			expect:      fmt.Errorf(`line 2: strconv.ParseFloat: parsing "n/a": invalid syntax`),
+			expectError: true,
+		},
+		{
+			name: "filter by field missing field",
+			stages: []StageFn{
+				Insert("alice 42\ndave\n"),
+				FilterByField("\n", "", 1, ">", 0, ErrorOnNonNumeric),
+			},
+			expect:      fmt.Errorf("line 2 has no field 1: dave"),
+			expectError: true,
+		},
+		{
+			name: "filter by field keeps trailing newline",
+			stages: []StageFn{
+				Insert("a 1\nb 5\n"),
+				FilterByField("\n", "", 1, ">", 2),
+			},
+			expect:      "b 5\n",
+			expectError: false,
+		},
+		{
+			name: "filter by field no match",
+			stages: []StageFn{
+				Insert("a 1\nb 5\n"),
+				FilterByField("\n", "", 1, ">", 10),
+			},
+			expect:      "",
+			expectError: false,
+		},
+		{
+			name: "filter by field unknown operator",
+			stages: []StageFn{
+				Insert("alice 42"),
+				FilterByField("\n", "", 1, "=~", 0),
+			},
+			expect:      fmt.Errorf("unknown comparison operator: =~"),
+			expectError: true,
+		},
+		{
+			name: "column",
+			stages: []StageFn{
+				Insert("root  1  init\nbob 42 bash\n"),
+				Column("\n", "", 1),
+			},
+			expect:      "1\n42\n",
+			expectError: false,
+		},
+		{
+			name: "column from end",
+			stages: []StageFn{
+				Insert("a:b:c\nd\n\ne:f"),
+				Column("\n", ":", -2),
+			},
+			expect:      "b\n\n\ne",
+			expectError: false,
+		},
+		{
+			name: "column skip missing",
+			stages: []StageFn{
+				Insert("a:b:c\nd\n\ne:f"),
+				Column("\n", ":", -2, SkipMissingFields),
+			},
+			expect:      "b\ne",
+			expectError: false,
+		},
+		{
+			name: "count unique",
+			stages: []StageFn{
+				Insert("b\na\nb\nc\nb\nc\n"),
+				CountUnique("\n"),
+			},
+			expect:      []LineCount{{Line: "a", Count: 1}, {Line: "b", Count: 3}, {Line: "c", Count: 2}},
+			expectError: false,
+		},
+		{
+			name: "count unique by count",
+			stages: []StageFn{
+				Insert("b\na\nb\nc\nb\nc\nd"),
+				CountUnique("\n", SortByCount),
+			},
+			expect:      []LineCount{{Line: "b", Count: 3}, {Line: "c", Count: 2}, {Line: "a", Count: 1}, {Line: "d", Count: 1}},
+			expectError: false,
+		},
+		{
+			name: "bytes",
+			stages: []StageFn{
+				Insert("hello"),
+				Bytes(func(b []byte) ([]byte, error) {
+					return bytes.ToUpper(b), nil
+				}),
+			},
+			expect:      []byte("HELLO"),
+			expectError: false,
+		},
+		{
+			name: "bytes error",
+			stages: []StageFn{
+				Insert([]byte("hello")),
+				Bytes(func(b []byte) ([]byte, error) {
+					return nil, fmt.Errorf("failed")
+				}),
+			},
+			expect:      fmt.Errorf("failed"),
+			expectError: true,
+		},
+		{
+			name: "str",
+			stages: []StageFn{
+				Insert([]byte("hello")),
+				Str(func(s string) (string, error) {
+					return strings.Repeat(s, 2), nil
+				}),
+			},
+			expect:      "hellohello",
+			expectError: false,
+		},
+		{
+			name: "str invalid input",
+			stages: []StageFn{
+				Insert(42),
+				Str(func(s string) (string, error) {
+					return s, nil
+				}),
+			},
+			expect:      fmt.Errorf("provided input must be string or []byte"),
+			expectError: true,
+		},
+		{
+			name: "normalize line endings to lf",
+			stages: []StageFn{
+				Insert("a\r\nb\nc\r\n"),
+				NormalizeLineEndings("lf"),
+			},
+			expect:      []byte("a\nb\nc\n"),
+			expectError: false,
+		},
+		{
+			name: "normalize line endings to crlf",
+			stages: []StageFn{
+				Insert([]byte("a\r\nb\nc")),
+				NormalizeLineEndings("crlf"),
+			},
+			expect:      []byte("a\r\nb\r\nc"),
+			expectError: false,
+		},
+		{
+			name: "normalize line endings already crlf",
+			stages: []StageFn{
+				Insert("a\r\nb\r\n"),
+				NormalizeLineEndings("crlf"),
+			},
+			expect:      []byte("a\r\nb\r\n"),
+			expectError: false,
+		},
+		{
+			name: "normalize line endings unknown style",
+			stages: []StageFn{
+				Insert("a"),
+				NormalizeLineEndings("cr"),
+			},
+			expect:      fmt.Errorf("unknown line ending style: cr, supported: lf, crlf"),
+			expectError: true,
+		},
+		{
+			name: "wrap lines",
+			stages: []StageFn{
+				Insert("the quick brown fox jumps\n\nover  the lazy dog\n"),
+				WrapLines(10),
+			},
+			expect:      "the quick\nbrown fox\njumps\n\nover the\nlazy dog\n",
+			expectError: false,
+		},
+		{
+			name: "wrap lines long word",
+			stages: []StageFn{
+				Insert([]byte("a abcdefghij b")),
+				WrapLines(4),
+			},
+			expect:      "a\nabcd\nefgh\nij b",
+			expectError: false,
+		},
+		{
+			name: "wrap lines invalid width",
+			stages: []StageFn{
+				Insert("a"),
+				WrapLines(0),
+			},
+			expect:      fmt.Errorf("width must be at least 1, got: 0"),
+			expectError: true,
+		},
+		{
+			name: "extract all",
+			stages: []StageFn{
+				Insert("id=1 name=bob id=22 id="),
+				ExtractAll(`id=(\d+)`, 1),
+			},
+			expect:      []string{"1", "22"},
+			expectError: false,
+		},
+		{
+			name: "extract all whole match",
+			stages: []StageFn{
+				Insert([]byte("id=1 name=bob id=22")),
+				ExtractAll(`\w+=\w+`, 0),
+			},
+			expect:      []string{"id=1", "name=bob", "id=22"},
+			expectError: false,
+		},
+		{
+			name: "extract all no matches",
+			stages: []StageFn{
+				Insert("name=bob"),
+				ExtractAll(`id=(\d+)`, 1),
+			},
+			expect:      []string{},
+			expectError: false,
+		},
+		{
+			name: "extract all invalid group",
+			stages: []StageFn{
+				Insert("id=1"),
+				ExtractAll(`id=(\d+)`, 2),
+			},
+			expect:      fmt.Errorf("group 2 out of range, pattern has 1 groups"),
+			expectError: true,
+		},
+		{
+			name: "extract all invalid pattern",
+			stages: []StageFn{
+				Insert("id=1"),
+				ExtractAll(`id=(`, 1),
+			},
+			expect:      fmt.Errorf("error parsing regexp: missing closing ): `id=(`"),
+			expectError: true,
+		},
+		{
+			name: "parse named",
+			stages: []StageFn{
+				Insert("bob 42\n# comment\nalice 7\n"),
+				ParseNamed(`^(?P<name>\w+) (?P<age>\d+)$`),
+			},
+			expect: []map[string]string{
+				{"name": "bob", "age": "42"},
+				{"name": "alice", "age": "7"},
+			},
+			expectError: false,
+		},
+		{
+			name: "parse named mismatch",
+			stages: []StageFn{
+				Insert("bob 42\n# comment\nalice 7\n"),
+				ParseNamed(`^(?P<name>\w+) (?P<age>\d+)$`, ErrorOnMismatch),
+			},
+			expect:      fmt.Errorf("line 2 doesn't match pattern: # comment"),
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		got, err := Run(nil, tc.stages...)
+		if tc.expectError {
+			assert.Equal(t, tc.expect.(error).Error(), err.Error(), tc.name)
+		} else {
+			assert.Equal(t, tc.expect, got, tc.name)
+			assert.Nil(t, err, tc.name)
+		}
+	}
+}
+
+func TestSetOp(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	assert.Nil(t, err)
+	other := path.Join(dir, "other")
+	assert.Nil(t, ioutil.WriteFile(other, []byte("b\nc\nd\n"), 0644))
+
+	testCases := []struct {
+		name        string
+		stages      []StageFn
+		expect      interface{}
+		expectError bool
+	}{
+		{
+			name: "intersect",
+			stages: []StageFn{
+				Insert("a\nb\nc\nb\n"),
+				SetOp("intersect", other),
+			},
+			expect:      "b\nc",
+			expectError: false,
+		},
+		{
+			name: "union",
+			stages: []StageFn{
+				Insert([]byte("c\r\na\r\n")),
+				SetOp("union", other),
+			},
+			expect:      "c\na\nb\nd",
+			expectError: false,
+		},
+		{
+			name: "difference with variable",
+			stages: []StageFn{
+				Insert("b\nd"),
+				SaveInVar("installed"),
+				Insert("a\nb\nc\nd"),
+				SetOp("difference", "#{installed}"),
+			},
+			expect:      "a\nc",
+			expectError: false,
+		},
+		{
+			name: "difference with file variable",
+			stages: []StageFn{
+				LoadFileHandler(other, os.O_RDONLY, 0),
+				SaveInVar("other"),
+				Insert("a\nb\n"),
+				SetOp("difference", "#{other}"),
+			},
+			expect:      "a",
+			expectError: false,
+		},
+		{
+			name: "missing variable",
+			stages: []StageFn{
+				Insert("a"),
+				SetOp("union", "#{missing}"),
+			},
+			expect:      fmt.Errorf("variable: missing doesn't exist"),
+			expectError: true,
+		},
+		{
+			name: "unknown operation",
+			stages: []StageFn{
+				Insert("a"),
+				SetOp("xor", other),
+			},
+			expect:      fmt.Errorf("unknown set operation: xor, supported: intersect, union, difference"),
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		got, err := Run(nil, tc.stages...)
+		if tc.expectError {
+			assert.Equal(t, tc.expect.(error).Error(), err.Error(), tc.name)
+		} else {
+			assert.Equal(t, tc.expect, got, tc.name)
+			assert.Nil(t, err, tc.name)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package do
+
+import "context"
+
+// Tracer is notified around each stage of a pipeline, e.g., to record a span
+// per stage with OpenTelemetry. Start is called with the context of the
+// pipeline and the function name of the stage, e.g., do.Exec.func1, before
+// the stage runs. The returned context is passed on to the stage, and end is
+// called with the error of the stage once it completes.
+type Tracer interface {
+	Start(ctx context.Context, stage string) (_ context.Context, end func(err error))
+}
+
+type tracerKey struct{}
+
+// WithTracer returns a copy of the context that makes RunContext notify the
+// tracer around each stage, including the stages of sub-pipelines
+func WithTracer(ctx context.Context, tracer Tracer) context.Context {
+	return context.WithValue(ctx, tracerKey{}, tracer)
+}
+
+// tracerOf returns the tracer of the context, if any
+func tracerOf(ctx context.Context) Tracer {
+	tracer, _ := ctx.Value(tracerKey{}).(Tracer)
+	return tracer
+}
@@ -0,0 +1,49 @@
+package do
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type spanKey struct{}
+
+type recordingTracer struct {
+	spans []string
+}
+
+func (r *recordingTracer) Start(ctx context.Context, stage string) (context.Context, func(err error)) {
+	return context.WithValue(ctx, spanKey{}, stage), func(err error) {
+		r.spans = append(r.spans, fmt.Sprintf("%s: %v", stage, err))
+	}
+}
+
+func TestTracer(t *testing.T) {
+	tracer := &recordingTracer{}
+	ctx := WithTracer(context.Background(), tracer)
+
+	_, err := RunContext(ctx, nil,
+		Insert("hello"),
+		Deadline(time.Minute, Exec(`echo -n "#{content}"`)),
+		WithContext(func(ctx context.Context, input interface{}, _ io.Writer) (interface{}, error) {
+			return ctx.Value(spanKey{}), nil
+		}),
+		Exec("exit 1"),
+	)
+	assert.Equal(t, "exit status 1", err.Error())
+	var pipelineErr *PipelineError
+	assert.True(t, errors.As(err, &pipelineErr))
+	assert.Equal(t, "do.WithContext.func1", pipelineErr.LastValue, "stages get the context of their span")
+	assert.Equal(t, []string{
+		"do.Insert.func1: <nil>",
+		"do.Exec.func1: <nil>",
+		"do.Deadline.func1: <nil>",
+		"do.WithContext.func1: <nil>",
+		"do.Exec.func1: exit status 1",
+	}, tracer.spans)
+}
@@ -0,0 +1,69 @@
+package do
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// encodings contains the character sets known by Transcode, keyed by their
+// lower case name
+var encodings = map[string]encoding.Encoding{
+	"utf-8":        unicode.UTF8,
+	"utf-16":       unicode.UTF16(unicode.BigEndian, unicode.UseBOM),
+	"utf-16be":     unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM),
+	"utf-16le":     unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM),
+	"latin1":       charmap.ISO8859_1,
+	"iso-8859-1":   charmap.ISO8859_1,
+	"iso-8859-2":   charmap.ISO8859_2,
+	"iso-8859-15":  charmap.ISO8859_15,
+	"windows-1250": charmap.Windows1250,
+	"windows-1251": charmap.Windows1251,
+	"windows-1252": charmap.Windows1252,
+	"koi8-r":       charmap.KOI8R,
+	"macintosh":    charmap.Macintosh,
+}
+
+func lookupEncoding(name string) (encoding.Encoding, error) {
+	if enc, ok := encodings[strings.ToLower(name)]; ok {
+		return enc, nil
+	}
+	var supported []string
+	for n := range encodings {
+		supported = append(supported, n)
+	}
+	sort.Strings(supported)
+	return nil, fmt.Errorf("unknown encoding: %s, supported: %s", name, strings.Join(supported, ", "))
+}
+
+// Transcode converts the content of the previous stage from one named character
+// encoding to another, e.g., Transcode("windows-1252", "utf-8"). The names are
+// case insensitive.
+func Transcode(from, to string) StageFn {
+	return func(input interface{}, progress io.Writer) (interface{}, error) {
+		fromEnc, err := lookupEncoding(from)
+		if err != nil {
+			return nil, err
+		}
+		toEnc, err := lookupEncoding(to)
+		if err != nil {
+			return nil, err
+		}
+		content, err := contentOf(input)
+		if err != nil {
+			return nil, err
+		}
+		ReportProgress(progress, "Transcoding content from %s to %s", from, to)
+
+		decoded, err := fromEnc.NewDecoder().Bytes(content)
+		if err != nil {
+			return nil, err
+		}
+		return toEnc.NewEncoder().Bytes(decoded)
+	}
+}
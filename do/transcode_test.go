@@ -0,0 +1,55 @@
+package do
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTranscode(t *testing.T) {
+	testCases := []struct {
+		name        string
+		stages      []StageFn
+		expect      interface{}
+		expectError bool
+	}{
+		{
+			name: "latin1 to utf-8",
+			stages: []StageFn{
+				Insert([]byte{'c', 'a', 'f', 0xe9}),
+				Transcode("ISO-8859-1", "utf-8"),
+			},
+			expect:      []byte("café"),
+			expectError: false,
+		},
+		{
+			name: "utf-8 to windows-1252",
+			stages: []StageFn{
+				Insert("€"),
+				Transcode("utf-8", "windows-1252"),
+			},
+			expect:      []byte{0x80},
+			expectError: false,
+		},
+		{
+			name: "unknown encoding",
+			stages: []StageFn{
+				Insert("hello"),
+				Transcode("ebcdic", "utf-8"),
+			},
+			expect:      fmt.Errorf("unknown encoding: ebcdic, supported: iso-8859-1, iso-8859-15, iso-8859-2, koi8-r, latin1, macintosh, utf-16, utf-16be, utf-16le, utf-8, windows-1250, windows-1251, windows-1252"),
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		got, err := Run(nil, tc.stages...)
+		if tc.expectError {
+			assert.Equal(t, tc.expect.(error).Error(), err.Error(), tc.name)
+		} else {
+			assert.Equal(t, tc.expect, got, tc.name)
+			assert.Nil(t, err, tc.name)
+		}
+	}
+}
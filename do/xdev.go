@@ -0,0 +1,15 @@
+//go:build !plan9
+// +build !plan9
+
+package do
+
+import (
+	"errors"
+	"syscall"
+)
+
+// isCrossDevice reports whether a rename failed as the destination is on a
+// different device
+func isCrossDevice(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
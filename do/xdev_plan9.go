@@ -0,0 +1,15 @@
+package do
+
+import (
+	"errors"
+	"os"
+)
+
+// isCrossDevice reports whether a rename failed as the destination is on a
+// different device. Plan 9 has no EXDEV, and only renames within the same
+// directory, so any rename of an existing file that fails is retried by
+// copying.
+func isCrossDevice(err error) bool {
+	var linkErr *os.LinkError
+	return errors.As(err, &linkErr) && !os.IsNotExist(err)
+}
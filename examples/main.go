@@ -2,7 +2,6 @@ package main
 
 import (
 	"fmt"
-	"io"
 	"os"
 
 	"github.com/paulbes/go-do/do"
@@ -14,21 +13,20 @@ type GreetingSubject struct {
 }
 
 func main() {
-	// We ignore the result and error here, but the result
-	// will contain the data of the last executed stage
-	_, _ = do.Run(os.Stdout,
+	// The output of the last executed stage is assigned to out
+	var out []byte
+	_, err := do.Run(os.Stdout,
 		do.Insert("hello"),
 		do.SaveInVar("greeting"),
 		do.Insert(GreetingSubject{Name: "bob"}),
 		do.MarshalJSON,
 		do.WriteTempFile,
 		do.Exec(`echo -n "#{greeting}" && cat #{file}`),
-		func(input interface{}, _ io.Writer) (interface{}, error) {
-			switch d := input.(type) {
-			case []byte:
-				fmt.Println("\nGot output: " + string(d))
-			}
-			return nil, nil
-		},
+		do.Into(&out),
 	)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Println("\nGot output: " + string(out))
 }